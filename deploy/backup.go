@@ -0,0 +1,498 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+
+	marathon "github.com/fbcbarbosa/go-marathon"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// ManifestFile is the file of a backup listing its definitions. Marathon ids
+// can not hold underscores, so no definition file clashes with it.
+const ManifestFile = "_manifest.yaml"
+
+// Kinds of the definitions of a backup
+const (
+	KindApp = "app"
+	KindPod = "pod"
+)
+
+// Manifest lists the definitions of a backup
+type Manifest struct {
+	Server    string          `json:"server,omitempty"`
+	CreatedAt string          `json:"createdAt"`
+	Entries   []ManifestEntry `json:"entries"`
+}
+
+// ManifestEntry is a definition of a backup
+type ManifestEntry struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+	// File is the path of the definition, relative to the backup directory
+	File         string   `json:"file"`
+	Version      string   `json:"version,omitempty"`
+	Dependencies []string `json:"dependencies,omitempty"`
+}
+
+// BackupOptions configures a Backup
+type BackupOptions struct {
+	// Dir is the directory the definitions are written to, one YAML file per
+	// app or pod under the path of its group
+	Dir string
+	// Server is recorded in the manifest
+	Server string
+	// Networks writes the definitions in the Marathon 1.5 networking format
+	Networks bool
+}
+
+// RestoreOptions configures a Restore
+type RestoreOptions struct {
+	// Dir is the directory of the backup
+	Dir string
+	// Prefix only restores the definitions under the group, all of them
+	// when empty
+	Prefix string
+	// DryRun only logs the definitions that would be restored
+	DryRun bool
+}
+
+// Backup writes the definitions of every app and pod of the cluster to
+// opts.Dir along with a manifest, which it returns. Apps keep the fields
+// modelled by go-marathon but the ones managed by Marathon, the others are
+// neither backed up nor restored.
+func Backup(client Client, opts BackupOptions) (*Manifest, error) {
+	ctx := log.WithFields(log.Fields{
+		"mode": "backup",
+		"dir":  opts.Dir,
+	})
+
+	root, err := client.Group("/")
+
+	if err != nil {
+		ctx.WithError(err).Error("failed to get groups")
+		return nil, err
+	}
+
+	defs := map[string]map[string]interface{}{}
+	manifest := &Manifest{
+		Server:    opts.Server,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	for _, app := range groupApps(root) {
+		def, err := backupApp(app)
+
+		if err == nil && opts.Networks {
+			_, err = MigrateNetworking(def)
+		}
+
+		if err != nil {
+			ctx.WithError(err).WithField("app", app.ID).Error("failed to back up application")
+			return nil, err
+		}
+
+		entry := ManifestEntry{
+			ID:           normalizeID(app.ID),
+			Kind:         KindApp,
+			File:         strings.Trim(app.ID, "/") + ".yaml",
+			Version:      app.Version,
+			Dependencies: dependencies(app),
+		}
+
+		defs[entry.File] = def
+		manifest.Entries = append(manifest.Entries, entry)
+	}
+
+	pods, err := listPods(client)
+
+	if err != nil {
+		ctx.WithError(err).Error("failed to list pods")
+		return nil, err
+	}
+
+	for _, pod := range pods {
+		def, err := backupPod(pod)
+
+		if err != nil {
+			ctx.WithError(err).WithField("pod", pod.ID).Error("failed to back up pod")
+			return nil, err
+		}
+
+		entry := ManifestEntry{
+			ID:      normalizeID(pod.ID),
+			Kind:    KindPod,
+			File:    strings.Trim(pod.ID, "/") + ".pod.yaml",
+			Version: pod.Version,
+		}
+
+		defs[entry.File] = def
+		manifest.Entries = append(manifest.Entries, entry)
+	}
+
+	if len(defs) != len(manifest.Entries) {
+		err := errors.New("several definitions map to the same file")
+		ctx.Error(err)
+		return nil, err
+	}
+
+	for file, def := range defs {
+		if err := writeYAML(filepath.Join(opts.Dir, filepath.FromSlash(file)), def); err != nil {
+			ctx.WithError(err).WithField("file", file).Error("failed to write definition")
+			return nil, err
+		}
+	}
+
+	if err := writeYAML(filepath.Join(opts.Dir, ManifestFile), manifest); err != nil {
+		ctx.WithError(err).Error("failed to write manifest")
+		return nil, err
+	}
+
+	ctx.WithField("definitions", len(manifest.Entries)).Info("backup written")
+	return manifest, nil
+}
+
+// groupApps returns the apps of the group tree
+func groupApps(group *marathon.Group) []*marathon.Application {
+	apps := group.Apps
+
+	for _, g := range group.Groups {
+		apps = append(apps, groupApps(g)...)
+	}
+
+	return apps
+}
+
+// dependencies returns the absolute ids of the app dependencies
+func dependencies(app *marathon.Application) []string {
+	var deps []string
+
+	for _, dep := range app.Dependencies {
+		if !strings.HasPrefix(dep, "/") {
+			dep = path.Join(path.Dir(normalizeID(app.ID)), dep)
+		}
+		deps = append(deps, dep)
+	}
+
+	return deps
+}
+
+func listPods(client Client) ([]marathon.Pod, error) {
+	supported, err := client.SupportsPods()
+
+	if err != nil || !supported {
+		return nil, err
+	}
+
+	return client.Pods()
+}
+
+func backupApp(app *marathon.Application) (map[string]interface{}, error) {
+	def, err := toDefinition(app)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range managedFields {
+		delete(def, field)
+	}
+
+	prune(def)
+	return def, nil
+}
+
+func backupPod(pod marathon.Pod) (map[string]interface{}, error) {
+	def, err := toDefinition(&pod)
+
+	if err != nil {
+		return nil, err
+	}
+
+	delete(def, "version")
+	prune(def)
+	return def, nil
+}
+
+// toDefinition converts v to a generic definition through its JSON encoding
+func toDefinition(v interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var def map[string]interface{}
+
+	if err := json.Unmarshal(b, &def); err != nil {
+		return nil, err
+	}
+
+	return def, nil
+}
+
+func writeYAML(file string, v interface{}) error {
+	b, err := yaml.Marshal(v)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, b, 0644)
+}
+
+// ReadManifest reads the manifest of the backup in dir
+func ReadManifest(dir string) (*Manifest, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, ManifestFile))
+
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{}
+
+	if err := yaml.Unmarshal(b, manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %v", err)
+	}
+
+	return manifest, nil
+}
+
+// Restore creates the apps and pods of the backup in opts.Dir missing from
+// the cluster and returns their ids. Apps are created after their
+// dependencies, waiting for the deployments of each level of dependencies.
+func (d *Deployer) Restore(c context.Context, opts RestoreOptions) ([]string, error) {
+	ctx := log.WithFields(log.Fields{
+		"mode":   "restore",
+		"dir":    opts.Dir,
+		"prefix": opts.Prefix,
+	})
+
+	manifest, err := ReadManifest(opts.Dir)
+
+	if err != nil {
+		ctx.WithError(err).Error("failed to read the backup")
+		return nil, err
+	}
+
+	missing, err := d.missing(ctx, manifest, opts.Prefix)
+
+	if err != nil {
+		return nil, err
+	}
+
+	levels, err := dependencyLevels(missing)
+
+	if err != nil {
+		ctx.Error(err)
+		return nil, err
+	}
+
+	var restored []string
+
+	for i, level := range levels {
+		for _, entry := range level {
+			ctx.WithFields(log.Fields{
+				"id":    entry.ID,
+				"kind":  entry.Kind,
+				"level": i,
+			}).Info("restoring definition")
+		}
+
+		if opts.DryRun {
+			for _, entry := range level {
+				restored = append(restored, entry.ID)
+			}
+			continue
+		}
+
+		var deployments []string
+
+		for _, entry := range level {
+			dep, err := d.restore(opts.Dir, entry)
+
+			if err != nil {
+				ctx.WithError(err).WithField("id", entry.ID).Error("failed to restore definition")
+				return restored, err
+			}
+
+			if dep != nil {
+				deployments = append(deployments, dep.DeploymentID)
+			}
+
+			restored = append(restored, entry.ID)
+		}
+
+		for _, id := range deployments {
+			if err := waitOnDeployment(c, d.client, id, d.opts.Timeout, nil, 0, nil); err != nil {
+				ctx.WithError(err).WithField("deployment", id).Error("restore deployment failed")
+				return restored, err
+			}
+		}
+	}
+
+	if opts.DryRun {
+		ctx.WithField("definitions", len(restored)).Info("dry run, not restoring definitions")
+		return restored, nil
+	}
+
+	ctx.WithField("restored", len(restored)).Info("backup restored")
+	return restored, nil
+}
+
+// missing returns the entries of the manifest under the prefix that do not
+// exist in the cluster
+func (d *Deployer) missing(ctx *log.Entry, manifest *Manifest, prefix string) ([]ManifestEntry, error) {
+	pods := map[string]bool{}
+	podsListed := false
+	var missing []ManifestEntry
+
+	for _, entry := range manifest.Entries {
+		if strings.Trim(prefix, "/") != "" && !underPrefix(entry.ID, prefix) {
+			continue
+		}
+
+		switch entry.Kind {
+		case KindApp:
+			_, err := d.client.Application(entry.ID)
+
+			if err == nil {
+				ctx.WithField("app", entry.ID).Info("application already exists")
+				continue
+			}
+
+			if !isNotFound(err) {
+				ctx.WithError(err).WithField("app", entry.ID).Error("failed to get application")
+				return nil, err
+			}
+
+		case KindPod:
+			if !podsListed {
+				list, err := listPods(d.client)
+
+				if err != nil {
+					ctx.WithError(err).Error("failed to list pods")
+					return nil, err
+				}
+
+				for _, pod := range list {
+					pods[normalizeID(pod.ID)] = true
+				}
+
+				podsListed = true
+			}
+
+			if pods[entry.ID] {
+				ctx.WithField("pod", entry.ID).Info("pod already exists")
+				continue
+			}
+
+		default:
+			err := fmt.Errorf("unknown kind %q of %s in the manifest", entry.Kind, entry.ID)
+			ctx.Error(err)
+			return nil, err
+		}
+
+		missing = append(missing, entry)
+	}
+
+	return missing, nil
+}
+
+// dependencyLevels groups the entries so each one comes after the level of
+// its dependencies. Dependencies outside the entries are expected to exist.
+func dependencyLevels(entries []ManifestEntry) ([][]ManifestEntry, error) {
+	pending := map[string]ManifestEntry{}
+
+	for _, entry := range entries {
+		pending[entry.ID] = entry
+	}
+
+	var levels [][]ManifestEntry
+
+	for len(pending) > 0 {
+		var level []ManifestEntry
+
+		for _, entry := range pending {
+			ready := true
+
+			for _, dep := range entry.Dependencies {
+				if _, ok := pending[dep]; ok {
+					ready = false
+					break
+				}
+			}
+
+			if ready {
+				level = append(level, entry)
+			}
+		}
+
+		if len(level) == 0 {
+			var ids []string
+
+			for id := range pending {
+				ids = append(ids, id)
+			}
+
+			sort.Strings(ids)
+			return nil, fmt.Errorf("circular dependencies between %s", strings.Join(ids, ", "))
+		}
+
+		sort.Slice(level, func(i, j int) bool { return level[i].ID < level[j].ID })
+
+		for _, entry := range level {
+			delete(pending, entry.ID)
+		}
+
+		levels = append(levels, level)
+	}
+
+	return levels, nil
+}
+
+// restore creates the definition of the entry, pods get no deployment to
+// wait on. Apps go through Parse, like the marathonfile, so the fields
+// go-marathon does not model are dropped.
+func (d *Deployer) restore(dir string, entry ManifestEntry) (*marathon.DeploymentID, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(entry.File)))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.Kind == KindPod {
+		pod := &marathon.Pod{}
+
+		if err := yaml.Unmarshal(b, pod); err != nil {
+			return nil, err
+		}
+
+		_, err := d.client.CreatePod(pod)
+		return nil, err
+	}
+
+	app, err := Parse(string(b))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return d.client.UpdateApplication(app, false)
+}
@@ -0,0 +1,215 @@
+package deploy
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/quintoandar/drone-marathon/marathontest"
+)
+
+func backupCluster(t *testing.T) (string, *Manifest) {
+	server, client := newTestServer(t)
+	defer server.Close()
+
+	addApps(t, server, "quintoandar/jobs/worker")
+
+	if _, err := server.AddApp("id: quintoandar/jobs/api\ndependencies: [worker]"); err != nil {
+		t.Fatalf("AddApp failed: \n%v", err)
+	}
+
+	if err := server.AddPod("id: quintoandar/sidecars\ncontainers: [{name: proxy}]"); err != nil {
+		t.Fatalf("AddPod failed: \n%v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "backup")
+
+	if err != nil {
+		t.Fatalf("TempDir failed: \n%v", err)
+	}
+
+	manifest, err := Backup(client, BackupOptions{Dir: dir})
+
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("Backup failed: \n%v", err)
+	}
+
+	return dir, manifest
+}
+
+func TestBackup(t *testing.T) {
+	dir, manifest := backupCluster(t)
+	defer os.RemoveAll(dir)
+
+	if len(manifest.Entries) != 4 {
+		t.Fatalf("unexpected manifest: \n%+v", manifest)
+	}
+
+	if read, err := ReadManifest(dir); err != nil || !reflect.DeepEqual(read, manifest) {
+		t.Fatalf("manifest was not written: %v \n%+v", err, read)
+	}
+
+	for _, file := range []string{"quintoandar/app.yaml", "quintoandar/jobs/api.yaml", "quintoandar/sidecars.pod.yaml"} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, file))
+
+		if err != nil {
+			t.Fatalf("definition was not written: \n%v", err)
+		}
+
+		if def := parseDefinition(t, string(b)); def["version"] != nil || def["tasks"] != nil || def["id"] == nil {
+			t.Fatalf("unexpected definition %s: \n%s", file, b)
+		}
+	}
+
+	for _, entry := range manifest.Entries {
+		if entry.ID == "/quintoandar/jobs/api" && !reflect.DeepEqual(entry.Dependencies, []string{"/quintoandar/jobs/worker"}) {
+			t.Fatalf("unexpected dependencies: %v", entry.Dependencies)
+		}
+	}
+}
+
+func TestRestore(t *testing.T) {
+	dir, _ := backupCluster(t)
+	defer os.RemoveAll(dir)
+
+	server := marathontest.NewServer()
+	defer server.Close()
+
+	if _, err := server.AddApp(app); err != nil {
+		t.Fatalf("AddApp failed: \n%v", err)
+	}
+
+	previous := server.AppVersion("quintoandar/app")
+	server.SetBehavior("quintoandar/jobs/worker", marathontest.Behavior{Duration: 50 * time.Millisecond})
+
+	d := New(newClient(t, server), Options{Timeout: time.Minute})
+
+	restored, err := d.Restore(context.Background(), RestoreOptions{Dir: dir, DryRun: true})
+
+	if err != nil || len(restored) != 3 || server.HasApp("quintoandar/jobs/worker") {
+		t.Fatalf("unexpected dry run: %v \n%v", restored, err)
+	}
+
+	restored, err = d.Restore(context.Background(), RestoreOptions{Dir: dir, Prefix: "quintoandar/jobs"})
+
+	if err != nil {
+		t.Fatalf("Restore failed: \n%v", err)
+	}
+
+	expected := []string{"/quintoandar/jobs/worker", "/quintoandar/jobs/api"}
+
+	if !reflect.DeepEqual(restored, expected) || server.HasPod("quintoandar/sidecars") {
+		t.Fatalf("unexpected restore: %v", restored)
+	}
+
+	if restored, err = d.Restore(context.Background(), RestoreOptions{Dir: dir}); err != nil {
+		t.Fatalf("Restore failed: \n%v", err)
+	}
+
+	if !reflect.DeepEqual(restored, []string{"/quintoandar/sidecars"}) || !server.HasPod("quintoandar/sidecars") {
+		t.Fatalf("unexpected restore: %v", restored)
+	}
+
+	if server.AppVersion("quintoandar/app") != previous {
+		t.Fatalf("existing application was redeployed")
+	}
+}
+
+func TestRestoreFields(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup")
+
+	if err != nil {
+		t.Fatalf("TempDir failed: \n%v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	manifest := &Manifest{Entries: []ManifestEntry{{ID: "/quintoandar/app", Kind: KindApp, File: "app.yaml"}}}
+
+	if err := writeYAML(filepath.Join(dir, ManifestFile), manifest); err != nil {
+		t.Fatalf("writeYAML failed: \n%v", err)
+	}
+
+	definition := `
+id: /quintoandar/app
+cmd: ./app
+env:
+  COLOR: blue
+  DB_PASSWORD: {secret: db}
+secrets:
+  db: {source: app/db}
+labels: {HAPROXY_GROUP: external}
+constraints: [[hostname, UNIQUE]]
+healthChecks: [{protocol: MESOS_HTTP, path: /health, intervalSeconds: 15}]
+upgradeStrategy: {minimumHealthCapacity: 1, maximumOverCapacity: 0.5}
+killSelection: OLDEST_FIRST
+role: quintoandar
+tty: true
+`
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "app.yaml"), []byte(definition), 0644); err != nil {
+		t.Fatalf("WriteFile failed: \n%v", err)
+	}
+
+	server := marathontest.NewServer()
+	defer server.Close()
+
+	client := newClient(t, server)
+
+	if _, err := New(client, Options{Timeout: time.Minute}).Restore(context.Background(), RestoreOptions{Dir: dir}); err != nil {
+		t.Fatalf("Restore failed: \n%v", err)
+	}
+
+	app, err := client.Application("quintoandar/app")
+
+	if err != nil {
+		t.Fatalf("Application failed: \n%v", err)
+	}
+
+	restored, err := backupApp(app)
+
+	if err != nil {
+		t.Fatalf("backupApp failed: \n%v", err)
+	}
+
+	expected := parseDefinition(t, definition)
+
+	// fields go-marathon does not model are lost
+	for _, field := range []string{"role", "tty"} {
+		if _, ok := restored[field]; ok {
+			t.Fatalf("%s was restored: \n%v", field, restored)
+		}
+		delete(expected, field)
+	}
+
+	for field, value := range expected {
+		if !reflect.DeepEqual(restored[field], value) {
+			t.Fatalf("%s was not restored: \n%v \n%v", field, restored[field], value)
+		}
+	}
+}
+
+func TestDependencyLevels(t *testing.T) {
+	levels, err := dependencyLevels([]ManifestEntry{
+		{ID: "/c", Dependencies: []string{"/b"}},
+		{ID: "/b", Dependencies: []string{"/a", "/external"}},
+		{ID: "/a"},
+		{ID: "/d"},
+	})
+
+	if err != nil || len(levels) != 3 || len(levels[0]) != 2 || levels[2][0].ID != "/c" {
+		t.Fatalf("unexpected levels: %v \n%v", levels, err)
+	}
+
+	if _, err := dependencyLevels([]ManifestEntry{
+		{ID: "/a", Dependencies: []string{"/b"}},
+		{ID: "/b", Dependencies: []string{"/a"}},
+	}); err == nil {
+		t.Fatalf("dependencyLevels accepted circular dependencies")
+	}
+}
@@ -0,0 +1,32 @@
+package deploy
+
+import (
+	"net/url"
+	"time"
+
+	marathon "github.com/fbcbarbosa/go-marathon"
+)
+
+// Client is the subset of the Marathon API used to deploy applications, any
+// marathon.Marathon satisfies it
+type Client interface {
+	Application(name string) (*marathon.Application, error)
+	Applications(v url.Values) (*marathon.Applications, error)
+	UpdateApplication(application *marathon.Application, force bool) (*marathon.DeploymentID, error)
+	SetApplicationVersion(name string, version *marathon.ApplicationVersion) (*marathon.DeploymentID, error)
+	ScaleApplicationInstances(name string, instances int, force bool) (*marathon.DeploymentID, error)
+	RestartApplication(name string, force bool) (*marathon.DeploymentID, error)
+	DeleteApplication(name string, force bool) (*marathon.DeploymentID, error)
+	Group(name string) (*marathon.Group, error)
+	DeleteGroup(name string, force bool) (*marathon.DeploymentID, error)
+	Tasks(application string) (*marathon.Tasks, error)
+	Deployments() ([]*marathon.Deployment, error)
+	HasDeployment(id string) (bool, error)
+	DeleteDeployment(id string, force bool) (*marathon.DeploymentID, error)
+	WaitOnDeployment(id string, timeout time.Duration) error
+	Queue() (*marathon.Queue, error)
+	DeleteQueueDelay(appID string) error
+	SupportsPods() (bool, error)
+	Pods() ([]marathon.Pod, error)
+	CreatePod(pod *marathon.Pod) (*marathon.Pod, error)
+}
@@ -0,0 +1,111 @@
+package deploy
+
+import (
+	"fmt"
+	"time"
+
+	marathon "github.com/fbcbarbosa/go-marathon"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// defaultCrashLoopWindow is used when Options.CrashLoopWindow is not set
+const defaultCrashLoopWindow = 2 * time.Minute
+
+// crashLoop detects the tasks of a deployment version repeatedly failing,
+// which Marathon keeps relaunching with a backoff until the deployment times
+// out. Failures are seen through the application last task failure, so the
+// deployment must be polled faster than tasks crash.
+type crashLoop struct {
+	client    Client
+	ctx       *log.Entry
+	app       string
+	version   string
+	threshold int
+	window    time.Duration
+	// failures holds the time of the failures seen by task id
+	failures map[string]time.Time
+	last     *marathon.LastTaskFailure
+}
+
+// newCrashLoop returns the crash loop detector configured in the options,
+// nil when disabled
+func (d *Deployer) newCrashLoop(ctx *log.Entry, appID, version string) *crashLoop {
+	if d.opts.CrashLoopThreshold <= 0 {
+		return nil
+	}
+
+	return &crashLoop{
+		client:    d.client,
+		ctx:       ctx,
+		app:       appID,
+		version:   version,
+		threshold: d.opts.CrashLoopThreshold,
+		window:    d.opts.crashLoopWindow(),
+		failures:  map[string]time.Time{},
+	}
+}
+
+// crashLoopError is returned by crashLoop.check, the deployment it stops
+// waiting on is still running
+type crashLoopError struct {
+	msg string
+}
+
+func (e *crashLoopError) Error() string {
+	return e.msg
+}
+
+func (o Options) crashLoopWindow() time.Duration {
+	if o.CrashLoopWindow > 0 {
+		return o.CrashLoopWindow
+	}
+	return defaultCrashLoopWindow
+}
+
+// check returns an error once threshold tasks of the version have failed
+// within the window, failing to get the application only skips the check
+func (l *crashLoop) check() error {
+	app, err := l.client.Application(l.app)
+
+	if err != nil {
+		l.ctx.WithError(err).Warning("failed to check the application for task failures")
+		return nil
+	}
+
+	f := app.LastTaskFailure
+	now := time.Now()
+
+	if f != nil && f.Version == l.version {
+		if _, seen := l.failures[f.TaskID]; !seen {
+			at, err := time.Parse(time.RFC3339, f.Timestamp)
+
+			if err != nil {
+				at = now
+			}
+
+			l.failures[f.TaskID] = at
+			l.last = f
+
+			l.ctx.WithFields(log.Fields{
+				"task":    f.TaskID,
+				"state":   f.State,
+				"message": f.Message,
+				"version": l.version,
+			}).Warning("task of the new version failed")
+		}
+	}
+
+	for id, at := range l.failures {
+		if now.Sub(at) > l.window {
+			delete(l.failures, id)
+		}
+	}
+
+	if len(l.failures) < l.threshold {
+		return nil
+	}
+
+	return &crashLoopError{fmt.Sprintf("tasks of version %s are crash looping, %d failed within %v, the last with %s: %s",
+		l.version, len(l.failures), l.window, l.last.State, l.last.Message)}
+}
@@ -0,0 +1,536 @@
+// Package deploy deploys applications to Marathon and rolls failed
+// deployments back to the previous application version. It holds the logic
+// behind the drone-marathon plugin so other tools can reuse it.
+package deploy
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	marathon "github.com/fbcbarbosa/go-marathon"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Actions taken on the in-flight deployment when the deploy is interrupted
+const (
+	CancelDeployment = "cancel"
+	CancelLeave      = "leave"
+	CancelRollback   = "rollback"
+)
+
+// Deploy phases, logged in the phase field
+const (
+	phasePrepare   = "prepare"
+	phasePreDeploy = "pre-deploy"
+	phaseDeploy    = "deploy"
+	phaseObserve   = "observe"
+	phaseRollback  = "rollback"
+	phaseCancel    = "cancel"
+)
+
+// deploymentPollInterval matches the go-marathon default polling wait time
+var deploymentPollInterval = 500 * time.Millisecond
+
+// taskPollInterval is how often tasks are checked while waiting on them to die
+var taskPollInterval = 5 * time.Second
+
+// Options configures a Deployer
+type Options struct {
+	// Timeout applies to the deployment
+	Timeout time.Duration
+	// DrainTimeout and RollbackTimeout apply to waiting on the tasks of a
+	// failed deployment to die and on the rollback deployment, they default
+	// to Timeout
+	DrainTimeout    time.Duration
+	RollbackTimeout time.Duration
+	// PreDeploy, if set, is a command run once with the application image
+	// before updating it, e.g. database migrations. The deploy goes on only
+	// when it succeeds within PreDeployTimeout, which defaults to Timeout.
+	PreDeploy        string
+	PreDeployTimeout time.Duration
+	// Deadline, if set, bounds the whole deploy. The deployment wait is
+	// shortened so the drain and rollback timeouts still fit in it.
+	Deadline time.Duration
+	// Rollback enables rolling failed deployments back to the previous version
+	Rollback bool
+	// OnCancel is the action taken on the in-flight deployment when the deploy
+	// context is cancelled, it must complete within CancelGrace
+	OnCancel    string
+	CancelGrace time.Duration
+	// Policy, if set, is evaluated before the application is updated
+	Policy     *Policy
+	PolicyMode string
+	// ProgressInterval is how often the deployment progress is logged while
+	// waiting on it, zero disables progress reporting
+	ProgressInterval time.Duration
+	// TTL, if set, labels deployed applications to expire after it, see GC
+	TTL time.Duration
+	// DestroyPrefix is the group Destroy and GC are restricted to, PruneGroups removes
+	// the groups left empty up to it
+	DestroyPrefix string
+	PruneGroups   bool
+	// ObserveWindow, if set, keeps watching the application once deployed,
+	// the deploy only succeeds when no task fails, gets killed or restarted
+	// and at least ObserveMinHealthy tasks, all instances by default, stay
+	// healthy until the window passes. Otherwise the previous version is
+	// redeployed when Rollback is enabled.
+	ObserveWindow     time.Duration
+	ObserveMinHealthy int
+	// CrashLoopThreshold, if set, fails the deployment as soon as that many
+	// tasks of the new version have failed within CrashLoopWindow, which
+	// defaults to 2 minutes, instead of waiting for the timeout
+	CrashLoopThreshold int
+	CrashLoopWindow    time.Duration
+	// ResetDelay resets the application launch delay, left by earlier failed
+	// tasks, before deploying. It is always reset before rolling back.
+	ResetDelay bool
+	// Status fetches the final application task counts into Result.Tasks
+	Status bool
+	// OnEvent is called on every deploy lifecycle event
+	OnEvent func(event string, result *Result, err error)
+}
+
+// Deployer deploys applications using a Marathon client
+type Deployer struct {
+	client Client
+	opts   Options
+}
+
+// New creates a Deployer
+func New(client Client, opts Options) *Deployer {
+	return &Deployer{client: client, opts: opts}
+}
+
+// Deploy applies the plugin defaults to app, updates it and waits for the
+// deployment to finish, rolling it back on failure when enabled. Cancelling c
+// interrupts the deploy and applies the OnCancel action.
+func (d *Deployer) Deploy(c context.Context, app *marathon.Application) (*Result, error) {
+	result := NewResult()
+	err := d.deploy(c, app, result)
+	result.Finish(err)
+	d.emit(result.Event(), result, err)
+	return result, err
+}
+
+func (d *Deployer) emit(event string, result *Result, err error) {
+	if d.opts.OnEvent != nil {
+		d.opts.OnEvent(event, result, err)
+	}
+}
+
+func (d *Deployer) deploy(c context.Context, app *marathon.Application, result *Result) error {
+	ctx := log.WithFields(log.Fields{
+		"app":   app.ID,
+		"phase": phasePrepare,
+	})
+	remaining := newBudget(d.opts.Deadline)
+	ctx.Info("applying configuration defaults")
+
+	result.App = app.ID
+
+	if d.opts.Status {
+		defer result.collect(d.client)
+	}
+
+	ApplyDefaults(app)
+
+	if d.opts.TTL > 0 {
+		stamp(app, time.Now(), d.opts.TTL)
+	}
+
+	if d.opts.Policy != nil {
+		if err := d.checkPolicy(ctx, app); err != nil {
+			return err
+		}
+	}
+
+	var prevVersion *marathon.ApplicationVersion
+
+	// load application in case we need to roll back
+	if d.opts.Rollback {
+		stableApp, err := d.client.Application(app.ID)
+
+		if err != nil {
+			ctx.WithError(err).Warning("could not get application information" +
+				" from marathon (only required in case of rollback)")
+		} else {
+			prevVersion = &marathon.ApplicationVersion{
+				Version: stableApp.Version,
+			}
+			result.PreviousVersion = stableApp.Version
+			ctx.WithField("version", stableApp.Version).Debug("previous application version loaded for rollback")
+		}
+	}
+
+	if err := c.Err(); err != nil {
+		ctx.Warning("deploy interrupted before updating the application")
+		return err
+	}
+
+	reserve := d.opts.ObserveWindow
+
+	if d.opts.Rollback {
+		reserve += d.opts.drainTimeout() + d.opts.rollbackTimeout()
+	}
+
+	if d.opts.PreDeploy != "" {
+		// the deploy itself must still fit once the task is done
+		timeout := remaining.timeout(d.opts.preDeployTimeout(), reserve+d.opts.Timeout)
+
+		if timeout <= 0 {
+			ctx.WithFields(log.Fields{
+				"deadline": d.opts.Deadline,
+				"reserve":  reserve + d.opts.Timeout,
+			}).Error(errNoDeployBudget)
+			return errNoDeployBudget
+		}
+
+		if err := d.preDeploy(c, ctx, app, timeout); err != nil {
+			return err
+		}
+	}
+
+	timeout := remaining.timeout(d.opts.Timeout, reserve)
+
+	if timeout <= 0 {
+		ctx.WithFields(log.Fields{
+			"deadline": d.opts.Deadline,
+			"reserve":  reserve,
+		}).Error(errNoDeployBudget)
+		return errNoDeployBudget
+	}
+
+	if d.opts.ResetDelay {
+		d.resetDelay(ctx, app.ID)
+	}
+
+	ctx.Info("updating application")
+
+	dep, err := d.client.UpdateApplication(app, true)
+
+	if err != nil {
+		ctx.WithError(err).Error("failed to start application update")
+		return err
+	}
+
+	result.Deployment = dep.DeploymentID
+	result.Version = dep.Version
+	d.emit(EventDeployStarted, result, nil)
+
+	ctx = ctx.WithField("phase", phaseDeploy)
+	start := time.Now()
+
+	ctx.WithFields(log.Fields{
+		"deployment": dep.DeploymentID,
+		"timeout":    timeout,
+		"version":    dep.Version,
+	}).Info("deploying application")
+
+	err = waitOnDeployment(c, d.client, dep.DeploymentID, timeout,
+		newProgress(d.client, ctx, app, dep), d.opts.ProgressInterval,
+		d.newCrashLoop(ctx, app.ID, dep.Version))
+
+	if err != nil && c.Err() != nil {
+		return d.interrupt(ctx, app.ID, dep, prevVersion, result)
+	}
+
+	if err != nil {
+
+		ctx.WithFields(log.Fields{
+			"err":         err,
+			"deployment":  dep.DeploymentID,
+			"duration_ms": durationMS(start),
+			"timeout":     timeout,
+			"version":     dep.Version,
+		}).Error("failed to deploy application")
+
+		if d.opts.Rollback {
+			result.Outcome = OutcomeRollbackFailed
+			d.emit(EventDeployFailed, result, err)
+			d.emit(EventRollbackStarted, result, nil)
+
+			if err := d.rollback(c, ctx, remaining, app.ID, dep, prevVersion, result); err != nil {
+				return err
+			}
+		} else {
+			ctx.WithField("deployment", dep.DeploymentID).Warning("rollback is not enabled")
+
+			// Marathon would relaunch the crashing tasks until the deployment
+			// times out, blocking the next deploys of the application
+			if _, ok := err.(*crashLoopError); ok {
+				ctx.WithField("deployment", dep.DeploymentID).Info("cancelling deployment")
+
+				if _, err := d.client.DeleteDeployment(dep.DeploymentID, true); err != nil {
+					ctx.WithError(err).Error("failed to cancel deployment")
+					return err
+				}
+			}
+		}
+
+		// override Marathon timeout error with a more descriptive error
+		if strings.Contains(err.Error(), "timed out") {
+			err = errors.New(
+				"could not deploy your application within the maximum timeout," +
+					" please check your application logs",
+			)
+		}
+
+		return err
+	}
+
+	ctx.WithFields(log.Fields{
+		"deployment":  dep.DeploymentID,
+		"duration_ms": durationMS(start),
+		"version":     dep.Version,
+	}).Info("application deployed successfully")
+
+	if d.opts.ObserveWindow > 0 {
+		return d.observe(c, ctx, remaining, app, dep, prevVersion, result)
+	}
+
+	return nil
+}
+
+// rollback cancels the failed deployment and redeploys the previous version
+func (d *Deployer) rollback(c context.Context, ctx *log.Entry, remaining budget, appID string,
+	dep *marathon.DeploymentID, prevVersion *marathon.ApplicationVersion, result *Result) error {
+
+	ctx = ctx.WithField("phase", phaseRollback)
+	start := time.Now()
+
+	ctx.WithFields(log.Fields{
+		"deployment": dep.DeploymentID,
+		"version":    dep.Version,
+	}).Info("cancelling deployment")
+
+	if _, err := d.client.DeleteDeployment(dep.DeploymentID, true); err != nil {
+		ctx.WithError(err).Error("failed to cancel deployment")
+		return err
+	}
+
+	if prevVersion == nil {
+		err := errors.New("no previous version available to roll back to")
+		ctx.Error(err)
+		return err
+	}
+
+	ctx.WithFields(log.Fields{
+		"deployment": dep.DeploymentID,
+		"version":    dep.Version,
+	}).Info("waiting for all failed tasks to die")
+
+	drainTimeout := remaining.timeout(d.opts.drainTimeout(), d.opts.rollbackTimeout())
+
+	if drainTimeout <= 0 {
+		ctx.Warning("the deadline leaves no time to wait for the failed tasks, rolling back right away")
+	} else if err := waitOnTasksToDie(c, d.client, appID, dep.Version, drainTimeout); err != nil {
+		ctx.WithError(err).Error("failed to rollback")
+		return err
+	}
+
+	return d.revert(c, ctx, start, remaining, appID, dep, prevVersion, result)
+}
+
+// revert redeploys the previous version in place of the deployed one
+func (d *Deployer) revert(c context.Context, ctx *log.Entry, start time.Time, remaining budget, appID string,
+	dep *marathon.DeploymentID, prevVersion *marathon.ApplicationVersion, result *Result) error {
+
+	rollbackTimeout := remaining.timeout(d.opts.rollbackTimeout(), 0)
+
+	if rollbackTimeout <= 0 {
+		ctx.WithFields(log.Fields{
+			"deadline": d.opts.Deadline,
+			"version":  prevVersion.Version,
+		}).Error(errNoRollbackBudget)
+		return errNoRollbackBudget
+	}
+
+	ctx.WithFields(log.Fields{
+		"deployment": dep.DeploymentID,
+		"timeout":    rollbackTimeout,
+		"version":    prevVersion.Version,
+	}).Info("rolling back to previous application version")
+
+	ctx.WithFields(log.Fields{
+		"deployment": dep.DeploymentID,
+		"timeout":    rollbackTimeout,
+		"version":    prevVersion.Version,
+	}).Info("a new rolling deployment will start")
+
+	d.resetDelay(ctx, appID)
+
+	rollback, err := d.client.SetApplicationVersion(appID, prevVersion)
+
+	if err != nil {
+		ctx.WithError(err).Error("failed to rollback")
+		return err
+	}
+
+	result.Rollback = rollback.DeploymentID
+
+	progress := &progress{
+		client:     d.client,
+		ctx:        ctx,
+		app:        appID,
+		deployment: rollback.DeploymentID,
+		version:    rollback.Version,
+	}
+
+	if err := waitOnDeployment(c, d.client, rollback.DeploymentID, rollbackTimeout,
+		progress, d.opts.ProgressInterval, nil); err != nil {
+
+		ctx.WithFields(log.Fields{
+			"err":         err,
+			"duration_ms": durationMS(start),
+			"rollback":    rollback.DeploymentID,
+			"timeout":     rollbackTimeout,
+			"version":     prevVersion.Version,
+		}).Error("failed to deploy rollback")
+
+		ctx.WithFields(log.Fields{
+			"rollback": rollback.DeploymentID,
+			"timeout":  rollbackTimeout,
+			"version":  prevVersion.Version,
+		}).Info("cancelling rollback")
+
+		if _, err := d.client.DeleteDeployment(rollback.DeploymentID, true); err != nil {
+			ctx.WithFields(log.Fields{
+				"err":      err,
+				"rollback": rollback.DeploymentID,
+				"version":  prevVersion.Version,
+			}).Error("failed to cancel rollback")
+			return err
+		}
+
+		// override Marathon timeout error with a more descriptive error
+		if strings.Contains(err.Error(), "timed out") {
+			err = errors.New(
+				"your rollback has failed and the application is at an" +
+					" unknown state, please check your application logs",
+			)
+		}
+
+		return err
+	}
+
+	ctx.WithFields(log.Fields{
+		"deployment":  dep.DeploymentID,
+		"duration_ms": durationMS(start),
+		"rollback":    rollback.DeploymentID,
+		"version":     prevVersion.Version,
+	}).Info("rollback was successful")
+
+	result.Outcome = OutcomeRolledBack
+	return nil
+}
+
+// interrupt handles a deploy interrupted while waiting on its deployment,
+// the OnCancel action must complete within the CancelGrace period
+func (d *Deployer) interrupt(ctx *log.Entry, appID string,
+	dep *marathon.DeploymentID, prevVersion *marathon.ApplicationVersion, result *Result) error {
+
+	ctx = ctx.WithField("phase", phaseCancel)
+	action := d.opts.OnCancel
+
+	// scale, restart, destroy and new apps have no previous version, all a
+	// rollback could do is cancel the deployment
+	if action == CancelRollback && prevVersion == nil {
+		action = CancelDeployment
+	}
+
+	ctx.WithFields(log.Fields{
+		"action":     action,
+		"deployment": dep.DeploymentID,
+		"grace":      d.opts.CancelGrace,
+		"version":    dep.Version,
+	}).Warning("deploy interrupted")
+
+	c, cancel := context.WithTimeout(context.Background(), d.opts.CancelGrace)
+	defer cancel()
+
+	switch action {
+	case CancelLeave:
+		ctx.WithField("deployment", dep.DeploymentID).Warning("leaving deployment running")
+
+	case CancelRollback:
+		result.Outcome = OutcomeRollbackFailed
+		d.emit(EventRollbackStarted, result, nil)
+
+		if err := d.rollback(c, ctx, budget{}, appID, dep, prevVersion, result); err != nil {
+			return err
+		}
+
+	default:
+		ctx.WithField("deployment", dep.DeploymentID).Info("cancelling deployment")
+
+		if _, err := d.client.DeleteDeployment(dep.DeploymentID, true); err != nil {
+			ctx.WithError(err).Error("failed to cancel deployment")
+			return err
+		}
+	}
+
+	return errors.New("deploy interrupted")
+}
+
+// durationMS returns the time elapsed since start for the duration_ms field
+func durationMS(start time.Time) int64 {
+	return int64(time.Since(start) / time.Millisecond)
+}
+
+// ApplyDefaults sets the plugin defaults on the application definition
+func ApplyDefaults(app *marathon.Application) {
+	// Set every uri extract to true by default
+	if app.Fetch != nil {
+		var fetch []marathon.Fetch
+		for _, v := range *app.Fetch {
+			v.Extract = true
+			fetch = append(fetch, v)
+		}
+		app.Fetch = &fetch
+	}
+
+	// Set faster default healthcheck timing configuration to avoid long rollbacks
+	if app.HealthChecks != nil {
+		for _, h := range *app.HealthChecks {
+			if h.GracePeriodSeconds == 0 {
+				h.GracePeriodSeconds = 60
+			}
+			if h.IntervalSeconds == 0 {
+				h.IntervalSeconds = 15
+			}
+			if h.TimeoutSeconds == 0 {
+				h.TimeoutSeconds = 10
+			}
+		}
+	}
+
+	if app.Container != nil && app.Container.Docker != nil {
+		app.Container.Docker.AddParameter("log-driver", "json-file")
+		app.Container.Docker.AddParameter("log-opt", "max-size=512m")
+	}
+}
+
+// checkPolicy evaluates the application against the policy, violations
+// only fail the deploy in enforce mode
+func (d *Deployer) checkPolicy(ctx *log.Entry, app *marathon.Application) error {
+	ctx.Info("evaluating deploy policy")
+	return d.enforcePolicy(ctx, d.opts.Policy.Evaluate(app))
+}
+
+// enforcePolicy reports the violations, which only fail in enforce mode
+func (d *Deployer) enforcePolicy(ctx *log.Entry, violations PolicyViolations) error {
+	if len(violations) == 0 {
+		return nil
+	}
+
+	if d.opts.PolicyMode == PolicyWarn {
+		ctx.Warn(violations.Error())
+		return nil
+	}
+
+	ctx.Error(violations.Error())
+	return violations
+}
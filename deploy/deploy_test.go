@@ -0,0 +1,286 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	marathon "github.com/fbcbarbosa/go-marathon"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var app = `
+id: quintoandar/app
+cpus: 0.1
+mem: 128
+container:
+  type: DOCKER
+  docker:
+    image: quintoandar/app
+    network: BRIDGE
+    portMappings:
+      - containerPort: 8080
+healthChecks:
+  - protocol: MESOS_HTTP
+    path: /health
+`
+
+// fakeClient is an in-memory Client, application updates start deployments
+// that either finish right away or never finish when hang is set
+type fakeClient struct {
+	Client
+	version     string
+	hang        bool
+	updated     *marathon.Application
+	rolledBack  string
+	deployments map[string]bool
+	cancelled   []string
+}
+
+func newFakeClient(hang bool) *fakeClient {
+	return &fakeClient{
+		version:     "2017-01-01T00:00:00.000Z",
+		hang:        hang,
+		deployments: map[string]bool{},
+	}
+}
+
+func (f *fakeClient) Application(name string) (*marathon.Application, error) {
+	return &marathon.Application{ID: name, Version: f.version}, nil
+}
+
+func (f *fakeClient) UpdateApplication(app *marathon.Application, force bool) (*marathon.DeploymentID, error) {
+	f.updated = app
+	f.deployments["deploy"] = f.hang
+	return &marathon.DeploymentID{DeploymentID: "deploy", Version: "2018-01-01T00:00:00.000Z"}, nil
+}
+
+func (f *fakeClient) SetApplicationVersion(name string, version *marathon.ApplicationVersion) (*marathon.DeploymentID, error) {
+	f.rolledBack = version.Version
+	return &marathon.DeploymentID{DeploymentID: "rollback", Version: version.Version}, nil
+}
+
+func (f *fakeClient) Tasks(name string) (*marathon.Tasks, error) {
+	return &marathon.Tasks{}, nil
+}
+
+func (f *fakeClient) Queue() (*marathon.Queue, error) {
+	return &marathon.Queue{}, nil
+}
+
+func (f *fakeClient) HasDeployment(id string) (bool, error) {
+	return f.deployments[id], nil
+}
+
+func (f *fakeClient) DeleteDeployment(id string, force bool) (*marathon.DeploymentID, error) {
+	f.cancelled = append(f.cancelled, id)
+	delete(f.deployments, id)
+	return nil, nil
+}
+
+func parseApp(t *testing.T, data string) *marathon.Application {
+	app, err := Parse(data)
+
+	if err != nil {
+		t.Fatalf("Parse failed: \n%v", err)
+	}
+
+	return app
+}
+
+func TestDeploySuccess(t *testing.T) {
+	client := newFakeClient(false)
+
+	result, err := New(client, Options{Timeout: time.Minute}).
+		Deploy(context.Background(), parseApp(t, app))
+
+	if err != nil {
+		t.Fatalf("Deploy failed: \n%v", err)
+	}
+
+	if result.Outcome != OutcomeSuccess || result.Deployment != "deploy" {
+		t.Fatalf("unexpected result: \n%+v", result)
+	}
+
+	if params := client.updated.Container.Docker.Parameters; params == nil || len(*params) != 2 {
+		t.Fatalf("defaults were not applied: \n%v", params)
+	}
+}
+
+func TestDeployRollback(t *testing.T) {
+	client := newFakeClient(true)
+
+	var events []string
+
+	opts := Options{
+		Timeout:  100 * time.Millisecond,
+		Rollback: true,
+		OnEvent: func(event string, result *Result, err error) {
+			events = append(events, event)
+		},
+	}
+
+	result, err := New(client, opts).Deploy(context.Background(), parseApp(t, app))
+
+	if err == nil {
+		t.Fatalf("Deploy did not fail")
+	}
+
+	if result.Outcome != OutcomeRolledBack || result.PreviousVersion != client.version {
+		t.Fatalf("unexpected result: \n%+v", result)
+	}
+
+	if client.rolledBack != client.version || !reflect.DeepEqual(client.cancelled, []string{"deploy"}) {
+		t.Fatalf("application was not rolled back: %q %v", client.rolledBack, client.cancelled)
+	}
+
+	expected := []string{
+		EventDeployStarted,
+		EventDeployFailed,
+		EventRollbackStarted,
+		EventRollbackSucceeded,
+	}
+
+	if !reflect.DeepEqual(events, expected) {
+		t.Fatalf("unexpected events: \n%v", events)
+	}
+}
+
+func TestApplyDefaultsHealthCheckTiming(t *testing.T) {
+	application := parseApp(t, app)
+	ApplyDefaults(application)
+
+	b, err := application.MarshalJSON()
+
+	if err != nil {
+		t.Fatalf("MarshalJSON failed: \n%v", err)
+	}
+
+	// left out so Marathon applies its own defaults
+	for _, field := range []string{"gracePeriodSeconds", "intervalSeconds", "timeoutSeconds"} {
+		if strings.Contains(string(b), field) {
+			t.Fatalf("health check %s was set: \n%s", field, b)
+		}
+	}
+}
+
+func TestDeployDeadline(t *testing.T) {
+	client := newFakeClient(true)
+
+	opts := Options{
+		Timeout:         time.Minute,
+		DrainTimeout:    100 * time.Millisecond,
+		RollbackTimeout: 100 * time.Millisecond,
+		Deadline:        400 * time.Millisecond,
+		Rollback:        true,
+	}
+
+	start := time.Now()
+	result, err := New(client, opts).Deploy(context.Background(), parseApp(t, app))
+
+	if err == nil {
+		t.Fatalf("Deploy did not fail")
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("deadline was not enforced: %v", elapsed)
+	}
+
+	if result.Outcome != OutcomeRolledBack {
+		t.Fatalf("deadline did not leave time to roll back: \n%+v", result)
+	}
+}
+
+func TestDeployDeadlineTooShort(t *testing.T) {
+	client := newFakeClient(false)
+
+	opts := Options{
+		Timeout:  time.Minute,
+		Deadline: time.Minute,
+		Rollback: true,
+	}
+
+	if _, err := New(client, opts).Deploy(context.Background(), parseApp(t, app)); err != errNoDeployBudget {
+		t.Fatalf("unexpected error: \n%v", err)
+	}
+
+	if client.updated != nil {
+		t.Fatalf("application was updated")
+	}
+}
+
+func TestBudgetExhausted(t *testing.T) {
+	remaining := budget{deadline: time.Now().Add(-time.Second)}
+
+	if timeout := remaining.timeout(time.Minute, 0); timeout != 0 {
+		t.Fatalf("exhausted budget gave a timeout of %v", timeout)
+	}
+
+	client := newFakeClient(false)
+	d := New(client, Options{Timeout: time.Minute, Deadline: time.Minute, Rollback: true})
+	dep := &marathon.DeploymentID{DeploymentID: "deploy", Version: "2018-01-01T00:00:00.000Z"}
+	prev := &marathon.ApplicationVersion{Version: client.version}
+
+	err := d.revert(context.Background(), log.WithField("app", "quintoandar/app"), time.Now(), remaining, "quintoandar/app", dep, prev, NewResult())
+
+	if err != errNoRollbackBudget {
+		t.Fatalf("unexpected error: \n%v", err)
+	}
+
+	if client.rolledBack != "" {
+		t.Fatalf("rollback was started without any time left")
+	}
+}
+
+func TestDeployInterrupted(t *testing.T) {
+	client := newFakeClient(true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	opts := Options{
+		Timeout:     time.Minute,
+		OnCancel:    CancelLeave,
+		CancelGrace: time.Second,
+	}
+
+	if _, err := New(client, opts).Deploy(ctx, parseApp(t, app)); err == nil {
+		t.Fatalf("Deploy did not fail")
+	}
+
+	if len(client.cancelled) > 0 {
+		t.Fatalf("deployment was cancelled: %v", client.cancelled)
+	}
+}
+
+func TestDeployPolicyViolation(t *testing.T) {
+	client := newFakeClient(false)
+
+	opts := Options{
+		Timeout: time.Minute,
+		Policy:  &Policy{MaxCPUs: 0.01},
+	}
+
+	_, err := New(client, opts).Deploy(context.Background(), parseApp(t, app))
+
+	if _, ok := err.(PolicyViolations); !ok {
+		t.Fatalf("Deploy did not fail with policy violations: \n%v", err)
+	}
+
+	if client.updated != nil {
+		t.Fatalf("application was updated")
+	}
+}
+
+func TestResultEvent(t *testing.T) {
+	result := NewResult()
+	result.Finish(errors.New("failed"))
+
+	if result.Outcome != OutcomeFailed || result.Event() != EventDeployFailed {
+		t.Fatalf("unexpected result: \n%+v", result)
+	}
+}
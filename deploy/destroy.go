@@ -0,0 +1,198 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	marathon "github.com/fbcbarbosa/go-marathon"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Destroy deletes the application or group id and waits for the deployment
+// to finish. The id must be under Options.DestroyPrefix, the groups left
+// empty up to the prefix are removed when Options.PruneGroups is set.
+// Destroying an id that does not exist succeeds.
+func (d *Deployer) Destroy(c context.Context, id string) (*Result, error) {
+	result := NewResult()
+	err := d.destroy(c, id, result)
+	result.Finish(err)
+	d.emit(result.Event(), result, err)
+	return result, err
+}
+
+func (d *Deployer) destroy(c context.Context, id string, result *Result) error {
+	remaining := newBudget(d.opts.Deadline)
+
+	ctx := log.WithFields(log.Fields{
+		"app":   normalizeID(id),
+		"mode":  "destroy",
+		"phase": phasePrepare,
+	})
+
+	result.App = normalizeID(id)
+
+	if hasParentSegment(id) {
+		err := fmt.Errorf("refusing to destroy %s, ids can not refer to a parent group", id)
+		ctx.Error(err)
+		return err
+	}
+
+	id = normalizeID(id)
+
+	if !underPrefix(id, d.opts.DestroyPrefix) {
+		err := fmt.Errorf("refusing to destroy %s, it is not under the destroy prefix %q", id, d.opts.DestroyPrefix)
+		ctx.Error(err)
+		return err
+	}
+
+	dep, err := d.delete(ctx, id)
+
+	if err != nil || dep == nil {
+		return err
+	}
+
+	result.Deployment = dep.DeploymentID
+	result.Version = dep.Version
+	d.emit(EventDeployStarted, result, nil)
+
+	if err := d.waitOnDelete(c, ctx, remaining, id, dep, result); err != nil {
+		return err
+	}
+
+	if d.opts.PruneGroups {
+		return d.prune(c, ctx, remaining, path.Dir(id), result)
+	}
+
+	return nil
+}
+
+// delete deletes id as an application, or as a group when there is no such
+// application. It returns no deployment when neither exists.
+func (d *Deployer) delete(ctx *log.Entry, id string) (*marathon.DeploymentID, error) {
+	_, err := d.client.Application(id)
+
+	if err == nil {
+		ctx.Info("deleting application")
+		return d.client.DeleteApplication(id, true)
+	}
+
+	if !isNotFound(err) {
+		ctx.WithError(err).Error("failed to get application")
+		return nil, err
+	}
+
+	if _, err := d.client.Group(id); err != nil {
+		if isNotFound(err) {
+			ctx.Warning("no application or group to destroy")
+			return nil, nil
+		}
+
+		ctx.WithError(err).Error("failed to get group")
+		return nil, err
+	}
+
+	ctx.Info("deleting group")
+	return d.client.DeleteGroup(id, true)
+}
+
+// prune deletes the groups left empty, walking up to the destroy prefix
+func (d *Deployer) prune(c context.Context, ctx *log.Entry, remaining budget, id string, result *Result) error {
+	for ; underPrefix(id, d.opts.DestroyPrefix); id = path.Dir(id) {
+		group, err := d.client.Group(id)
+
+		if isNotFound(err) {
+			continue
+		}
+
+		if err != nil {
+			ctx.WithError(err).WithField("group", id).Error("failed to get group")
+			return err
+		}
+
+		if len(group.Apps) > 0 || len(group.Groups) > 0 {
+			return nil
+		}
+
+		ctx.WithField("group", id).Info("deleting empty group")
+
+		dep, err := d.client.DeleteGroup(id, true)
+
+		if err != nil {
+			ctx.WithError(err).WithField("group", id).Error("failed to delete empty group")
+			return err
+		}
+
+		if err := d.waitOnDelete(c, ctx, remaining, id, dep, result); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Deployer) waitOnDelete(c context.Context, ctx *log.Entry, remaining budget, id string,
+	dep *marathon.DeploymentID, result *Result) error {
+
+	ctx = ctx.WithField("phase", phaseDeploy)
+	timeout := remaining.timeout(d.opts.Timeout, 0)
+	start := time.Now()
+
+	err := waitOnDeployment(c, d.client, dep.DeploymentID, timeout, nil, 0, nil)
+
+	if err != nil && c.Err() != nil {
+		return d.interrupt(ctx, id, dep, nil, result)
+	}
+
+	if err != nil {
+		ctx.WithFields(log.Fields{
+			"err":         err,
+			"deployment":  dep.DeploymentID,
+			"duration_ms": durationMS(start),
+			"timeout":     timeout,
+		}).Error("failed to delete")
+		return err
+	}
+
+	ctx.WithFields(log.Fields{
+		"deployment":  dep.DeploymentID,
+		"duration_ms": durationMS(start),
+	}).Info("deleted successfully")
+
+	return nil
+}
+
+// underPrefix reports whether id is strictly under the prefix group, an
+// empty or root prefix matches nothing
+func underPrefix(id, prefix string) bool {
+	prefix = strings.TrimSuffix(normalizeID(prefix), "/")
+
+	if prefix == "" {
+		return false
+	}
+
+	return strings.HasPrefix(normalizeID(id), prefix+"/")
+}
+
+// normalizeID returns the absolute, cleaned form of id
+func normalizeID(id string) string {
+	return path.Clean("/" + strings.Trim(id, "/"))
+}
+
+// hasParentSegment reports whether id refers to a parent group with ..
+func hasParentSegment(id string) bool {
+	for _, segment := range strings.Split(id, "/") {
+		if segment == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+func isNotFound(err error) bool {
+	apiErr, ok := err.(*marathon.APIError)
+	return ok && apiErr.ErrCode == marathon.ErrCodeNotFound
+}
@@ -0,0 +1,784 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quintoandar/drone-marathon/marathontest"
+
+	marathon "github.com/fbcbarbosa/go-marathon"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+func init() {
+	deploymentPollInterval = 10 * time.Millisecond
+	taskPollInterval = 10 * time.Millisecond
+}
+
+// newTestServer starts a fake Marathon running app and returns a client for it
+func newTestServer(t *testing.T) (*marathontest.Server, Client) {
+	server := marathontest.NewServer()
+
+	if _, err := server.AddApp(app); err != nil {
+		server.Close()
+		t.Fatalf("AddApp failed: \n%v", err)
+	}
+
+	return server, newClient(t, server)
+}
+
+// newClient returns a client for the fake Marathon, closing it on failure
+func newClient(t *testing.T, server *marathontest.Server) Client {
+	config := marathon.NewDefaultConfig()
+	config.URL = server.URL
+
+	client, err := marathon.NewClient(config)
+
+	if err != nil {
+		server.Close()
+		t.Fatalf("NewClient failed: \n%v", err)
+	}
+
+	return client
+}
+
+func TestEndToEndDeploy(t *testing.T) {
+	server, client := newTestServer(t)
+	defer server.Close()
+
+	server.SetBehavior("quintoandar/app", marathontest.Behavior{Duration: 50 * time.Millisecond})
+	previous := server.AppVersion("quintoandar/app")
+
+	result, err := New(client, Options{Timeout: time.Minute, Rollback: true, Status: true}).
+		Deploy(context.Background(), parseApp(t, app))
+
+	if err != nil {
+		t.Fatalf("Deploy failed: \n%v", err)
+	}
+
+	if result.Outcome != OutcomeSuccess || result.PreviousVersion != previous {
+		t.Fatalf("unexpected result: \n%+v", result)
+	}
+
+	if version := server.AppVersion("quintoandar/app"); version != result.Version || version == previous {
+		t.Fatalf("app was not updated: %q", version)
+	}
+
+	if result.Tasks == nil || result.Tasks.Healthy != 1 {
+		t.Fatalf("unexpected tasks: \n%+v", result.Tasks)
+	}
+}
+
+func TestEndToEndRollback(t *testing.T) {
+	server, client := newTestServer(t)
+	defer server.Close()
+
+	server.SetBehavior("quintoandar/app", marathontest.Behavior{Unhealthy: true})
+	previous := server.AppVersion("quintoandar/app")
+
+	result, err := New(client, Options{Timeout: 200 * time.Millisecond, Rollback: true}).
+		Deploy(context.Background(), parseApp(t, app))
+
+	if err == nil {
+		t.Fatalf("Deploy did not fail")
+	}
+
+	if result.Outcome != OutcomeRolledBack {
+		t.Fatalf("unexpected result: \n%+v", result)
+	}
+
+	if server.Deployments() != 0 {
+		t.Fatalf("deployments left running: %d", server.Deployments())
+	}
+
+	if version := server.AppVersion("quintoandar/app"); version == previous || version == result.Version {
+		t.Fatalf("app was not rolled back to a new version of the previous definition: %q", version)
+	}
+}
+
+func TestEndToEndMultipleApps(t *testing.T) {
+	server, client := newTestServer(t)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "marathon")
+
+	if err != nil {
+		t.Fatalf("TempDir failed: \n%v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	ids := []string{"/quintoandar/api", "/quintoandar/worker", "/quintoandar/web"}
+	previous := map[string]string{}
+	var files []string
+
+	for _, id := range ids {
+		definition := strings.Replace(app, "quintoandar/app", id, -1)
+
+		if previous[id], err = server.AddApp(definition); err != nil {
+			t.Fatalf("AddApp failed: \n%v", err)
+		}
+
+		file := filepath.Join(dir, path.Base(id)+".yaml")
+		files = append(files, file)
+
+		if err := ioutil.WriteFile(file, []byte(strings.Replace(definition, "cpus: 0.1", "cpus: 0.2", 1)), 0644); err != nil {
+			t.Fatalf("WriteFile failed: \n%v", err)
+		}
+	}
+
+	server.SetBehavior("/quintoandar/worker", marathontest.Behavior{Unhealthy: true})
+
+	deployer := New(client, Options{Timeout: 200 * time.Millisecond, Rollback: true})
+	var results []*Result
+
+	// deploy the marathonfiles in order, stopping at the first failure
+	for _, file := range files {
+		data, err := Input{Marathonfile: file}.Render()
+
+		if err != nil {
+			t.Fatalf("Render failed: \n%v", err)
+		}
+
+		result, err := deployer.Deploy(context.Background(), parseApp(t, data))
+		results = append(results, result)
+
+		if err != nil {
+			break
+		}
+	}
+
+	if len(results) != 2 || results[0].Outcome != OutcomeSuccess || results[1].Outcome != OutcomeRolledBack {
+		t.Fatalf("unexpected results: \n%+v", results)
+	}
+
+	if version := server.AppVersion("/quintoandar/api"); version != results[0].Version {
+		t.Fatalf("first app was not deployed: %q", version)
+	}
+
+	if version := server.AppVersion("/quintoandar/worker"); version == previous["/quintoandar/worker"] || version == results[1].Version {
+		t.Fatalf("second app was not rolled back: %q", version)
+	}
+
+	if version := server.AppVersion("/quintoandar/web"); version != previous["/quintoandar/web"] {
+		t.Fatalf("third app was deployed after the failure: %q", version)
+	}
+
+	if server.Deployments() != 0 {
+		t.Fatalf("deployments left running: %d", server.Deployments())
+	}
+}
+
+func TestEndToEndCrashLoop(t *testing.T) {
+	server, client := newTestServer(t)
+	defer server.Close()
+
+	server.SetBehavior("quintoandar/app", marathontest.Behavior{Crash: true})
+	start := time.Now()
+
+	result, err := New(client, Options{Timeout: time.Minute, Rollback: true, CrashLoopThreshold: 3}).
+		Deploy(context.Background(), parseApp(t, app))
+
+	if err == nil || !strings.Contains(err.Error(), "crash looping") {
+		t.Fatalf("Deploy did not fail on the crash loop: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("crash loop was detected after %v", elapsed)
+	}
+
+	if result.Outcome != OutcomeRolledBack {
+		t.Fatalf("unexpected result: \n%+v", result)
+	}
+
+	if server.Deployments() != 0 {
+		t.Fatalf("deployments left running: %d", server.Deployments())
+	}
+}
+
+func TestEndToEndCrashLoopWithoutRollback(t *testing.T) {
+	server, client := newTestServer(t)
+	defer server.Close()
+
+	server.SetBehavior("quintoandar/app", marathontest.Behavior{Crash: true})
+
+	result, err := New(client, Options{Timeout: time.Minute, CrashLoopThreshold: 3}).
+		Deploy(context.Background(), parseApp(t, app))
+
+	if err == nil || !strings.Contains(err.Error(), "crash looping") {
+		t.Fatalf("Deploy did not fail on the crash loop: %v", err)
+	}
+
+	if result.Outcome != OutcomeFailed {
+		t.Fatalf("unexpected result: \n%+v", result)
+	}
+
+	if server.Deployments() != 0 {
+		t.Fatalf("crash looping deployment was not cancelled: %d", server.Deployments())
+	}
+}
+
+func TestEndToEndResetDelay(t *testing.T) {
+	server, client := newTestServer(t)
+	defer server.Close()
+
+	server.SetBehavior("quintoandar/app", marathontest.Behavior{Crash: true})
+
+	// the crashed app stays delayed once its deployment is cancelled
+	if _, err := New(client, Options{Timeout: time.Minute, CrashLoopThreshold: 3}).
+		Deploy(context.Background(), parseApp(t, app)); err == nil {
+		t.Fatalf("Deploy did not fail")
+	}
+
+	server.SetBehavior("quintoandar/app", marathontest.Behavior{})
+
+	result, err := New(client, Options{Timeout: time.Second, ResetDelay: true}).
+		Deploy(context.Background(), parseApp(t, app))
+
+	if err != nil {
+		t.Fatalf("Deploy failed: \n%v", err)
+	}
+
+	if version := server.AppVersion("quintoandar/app"); version != result.Version {
+		t.Fatalf("unexpected app version %q, expected %q", version, result.Version)
+	}
+}
+
+func TestEndToEndObserve(t *testing.T) {
+	server, client := newTestServer(t)
+	defer server.Close()
+
+	start := time.Now()
+
+	result, err := New(client, Options{Timeout: time.Minute, Rollback: true, ObserveWindow: 100 * time.Millisecond}).
+		Deploy(context.Background(), parseApp(t, app))
+
+	if err != nil {
+		t.Fatalf("Deploy failed: \n%v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("Deploy returned before the observation window passed: %v", elapsed)
+	}
+
+	if version := server.AppVersion("quintoandar/app"); version != result.Version {
+		t.Fatalf("unexpected app version %q, expected %q", version, result.Version)
+	}
+}
+
+func TestEndToEndObserveDegraded(t *testing.T) {
+	server, client := newTestServer(t)
+	defer server.Close()
+
+	server.SetBehavior("quintoandar/app", marathontest.Behavior{
+		Duration: 50 * time.Millisecond,
+		Exit:     "TASK_FAILED",
+	})
+
+	result, err := New(client, Options{Timeout: time.Minute, Rollback: true, ObserveWindow: time.Minute}).
+		Deploy(context.Background(), parseApp(t, app))
+
+	if err == nil {
+		t.Fatalf("Deploy did not fail")
+	}
+
+	if result.Outcome != OutcomeRolledBack || result.Rollback == "" {
+		t.Fatalf("unexpected result: \n%+v", result)
+	}
+
+	if version := server.AppVersion("quintoandar/app"); version == result.Version {
+		t.Fatalf("app was not rolled back: %q", version)
+	}
+}
+
+func TestEndToEndInterrupted(t *testing.T) {
+	server, client := newTestServer(t)
+	defer server.Close()
+
+	server.SetBehavior("quintoandar/app", marathontest.Behavior{Hang: true})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	opts := Options{
+		Timeout:     time.Minute,
+		OnCancel:    CancelDeployment,
+		CancelGrace: time.Second,
+	}
+
+	if _, err := New(client, opts).Deploy(ctx, parseApp(t, app)); err == nil {
+		t.Fatalf("Deploy did not fail")
+	}
+
+	if server.Deployments() != 0 {
+		t.Fatalf("deployment was not cancelled")
+	}
+}
+
+func TestEndToEndScaleInterrupted(t *testing.T) {
+	server, client := newTestServer(t)
+	defer server.Close()
+
+	server.SetBehavior("quintoandar/app", marathontest.Behavior{Hang: true})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	var events []string
+
+	opts := Options{
+		Timeout:     time.Minute,
+		OnCancel:    CancelRollback,
+		CancelGrace: time.Second,
+		OnEvent: func(event string, result *Result, err error) {
+			events = append(events, event)
+		},
+	}
+
+	result, err := New(client, opts).Scale(ctx, "quintoandar/app", Scale{Instances: 2})
+
+	if err == nil || result.Outcome != OutcomeFailed {
+		t.Fatalf("Scale was not interrupted: \n%+v", result)
+	}
+
+	if server.Deployments() != 0 {
+		t.Fatalf("deployment was not cancelled")
+	}
+
+	for _, event := range events {
+		if event == EventRollbackStarted {
+			t.Fatalf("scale was rolled back: \n%v", events)
+		}
+	}
+}
+
+func TestEndToEndProgress(t *testing.T) {
+	server, client := newTestServer(t)
+	defer server.Close()
+
+	server.SetBehavior("quintoandar/app", marathontest.Behavior{Duration: 300 * time.Millisecond})
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	opts := Options{Timeout: time.Minute, ProgressInterval: 50 * time.Millisecond}
+
+	if _, err := New(client, opts).Deploy(context.Background(), parseApp(t, app)); err != nil {
+		t.Fatalf("Deploy failed: \n%v", err)
+	}
+
+	for _, expected := range []string{
+		"deployment in progress",
+		"actions=\"RestartApplication /quintoandar/app\"",
+		"step=1/1",
+		"target=1",
+		"staged=1",
+		"old_tasks=1",
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Fatalf("progress %q was not logged: \n%s", expected, buf.String())
+		}
+	}
+}
+
+func TestEndToEndScale(t *testing.T) {
+	server, client := newTestServer(t)
+	defer server.Close()
+
+	var events []string
+
+	opts := Options{
+		Timeout: time.Minute,
+		Status:  true,
+		OnEvent: func(event string, result *Result, err error) {
+			events = append(events, event)
+		},
+	}
+
+	result, err := New(client, opts).Scale(context.Background(), "quintoandar/app", Scale{Instances: 2, Delta: true})
+
+	if err != nil {
+		t.Fatalf("Scale failed: \n%v", err)
+	}
+
+	if result.Tasks == nil || result.Tasks.Instances != 3 || result.Tasks.Running != 3 {
+		t.Fatalf("app was not scaled: \n%+v", result.Tasks)
+	}
+
+	if len(events) != 2 || events[0] != EventDeployStarted || events[1] != EventDeploySucceeded {
+		t.Fatalf("unexpected events: \n%v", events)
+	}
+}
+
+func TestEndToEndScalePolicy(t *testing.T) {
+	server, client := newTestServer(t)
+	defer server.Close()
+
+	policy := &Policy{MaxInstances: 3, ForbidLatestTag: true}
+
+	_, err := New(client, Options{Timeout: time.Minute, Policy: policy}).
+		Scale(context.Background(), "quintoandar/app", Scale{Instances: 3, Delta: true})
+
+	if _, ok := err.(PolicyViolations); !ok {
+		t.Fatalf("Scale past the instances limit was allowed: %v", err)
+	}
+
+	if server.Deployments() != 0 {
+		t.Fatalf("a deployment was started: %d", server.Deployments())
+	}
+
+	// only the instances are checked when scaling
+	if _, err := New(client, Options{Timeout: time.Minute, Policy: policy}).
+		Scale(context.Background(), "quintoandar/app", Scale{Instances: 3}); err != nil {
+		t.Fatalf("Scale within the instances limit failed: \n%v", err)
+	}
+}
+
+func TestEndToEndRestart(t *testing.T) {
+	server, client := newTestServer(t)
+	defer server.Close()
+
+	server.SetBehavior("quintoandar/app", marathontest.Behavior{Hang: true})
+	previous := server.AppVersion("quintoandar/app")
+
+	result, err := New(client, Options{Timeout: 100 * time.Millisecond}).
+		Restart(context.Background(), "quintoandar/app")
+
+	if err == nil || result.Outcome != OutcomeFailed {
+		t.Fatalf("Restart did not time out: \n%+v", result)
+	}
+
+	server.SetBehavior("quintoandar/app", marathontest.Behavior{})
+
+	if _, err := client.DeleteDeployment(result.Deployment, true); err != nil {
+		t.Fatalf("DeleteDeployment failed: \n%v", err)
+	}
+
+	result, err = New(client, Options{Timeout: time.Minute}).
+		Restart(context.Background(), "quintoandar/app")
+
+	if err != nil {
+		t.Fatalf("Restart failed: \n%v", err)
+	}
+
+	if version := server.AppVersion("quintoandar/app"); version != result.Version || version == previous {
+		t.Fatalf("app was not restarted: %q", version)
+	}
+}
+
+func addApps(t *testing.T, server *marathontest.Server, ids ...string) {
+	for _, id := range ids {
+		if _, err := server.AddApp("id: " + id); err != nil {
+			t.Fatalf("AddApp failed: \n%v", err)
+		}
+	}
+}
+
+func TestEndToEndDestroy(t *testing.T) {
+	server, client := newTestServer(t)
+	defer server.Close()
+
+	addApps(t, server, "/previews/12/api", "/previews/12/web", "/previews/13/api")
+
+	deployer := New(client, Options{
+		Timeout:       time.Minute,
+		DestroyPrefix: "/previews",
+		PruneGroups:   true,
+	})
+
+	if _, err := deployer.Destroy(context.Background(), "previews/12/api"); err != nil {
+		t.Fatalf("Destroy failed: \n%v", err)
+	}
+
+	if server.HasApp("/previews/12/api") || !server.HasGroup("/previews/12") {
+		t.Fatalf("app was not destroyed or its non-empty group was pruned")
+	}
+
+	if _, err := deployer.Destroy(context.Background(), "/previews/12/web"); err != nil {
+		t.Fatalf("Destroy failed: \n%v", err)
+	}
+
+	if server.HasGroup("/previews/12") || !server.HasGroup("/previews") {
+		t.Fatalf("empty group was not pruned up to the prefix")
+	}
+
+	if _, err := deployer.Destroy(context.Background(), "/previews/13"); err != nil {
+		t.Fatalf("Destroy failed: \n%v", err)
+	}
+
+	if server.HasApp("/previews/13/api") || server.HasGroup("/previews/13") {
+		t.Fatalf("group was not destroyed")
+	}
+
+	if _, err := deployer.Destroy(context.Background(), "/previews/14"); err != nil {
+		t.Fatalf("Destroy of a missing id failed: \n%v", err)
+	}
+}
+
+func TestEndToEndDestroyPrefix(t *testing.T) {
+	server, client := newTestServer(t)
+	defer server.Close()
+
+	addApps(t, server, "/previews/12/api", "/previews-prod/api", "/prod/api")
+
+	for _, prefix := range []string{"", "/"} {
+		deployer := New(client, Options{Timeout: time.Minute, DestroyPrefix: prefix})
+
+		if _, err := deployer.Destroy(context.Background(), "/previews/12/api"); err == nil {
+			t.Fatalf("Destroy was allowed with prefix %q", prefix)
+		}
+	}
+
+	deployer := New(client, Options{Timeout: time.Minute, DestroyPrefix: "/previews/"})
+
+	for _, id := range []string{"/quintoandar/app", "/previews-prod/api", "/previews",
+		"/previews/../prod/api", "previews/12/../../prod/api", "/previews/12/.."} {
+		if _, err := deployer.Destroy(context.Background(), id); err == nil {
+			t.Fatalf("Destroy of %s was allowed", id)
+		}
+	}
+
+	if !server.HasApp("/quintoandar/app") || !server.HasApp("/previews-prod/api") ||
+		!server.HasApp("/prod/api") || !server.HasApp("/previews/12/api") {
+		t.Fatalf("app outside of the prefix was destroyed")
+	}
+}
+
+func TestUnderPrefix(t *testing.T) {
+	if underPrefix("/previews/../prod/api", "/previews") {
+		t.Fatalf("an id escaping the prefix with .. is under it")
+	}
+
+	if !underPrefix("previews//12/./api", "/previews") {
+		t.Fatalf("an id under the prefix is not under it once cleaned")
+	}
+}
+
+func TestEndToEndPreDeploy(t *testing.T) {
+	server, client := newTestServer(t)
+	defer server.Close()
+
+	previous := server.AppVersion("quintoandar/app")
+
+	opts := Options{
+		Timeout:   time.Minute,
+		PreDeploy: "./migrate",
+	}
+
+	server.SetBehavior("quintoandar/app-pre-deploy", marathontest.Behavior{
+		Duration: 50 * time.Millisecond,
+		Exit:     "TASK_FAILED",
+	})
+
+	if _, err := New(client, opts).Deploy(context.Background(), parseApp(t, app)); err == nil {
+		t.Fatalf("Deploy did not fail")
+	}
+
+	if server.AppVersion("quintoandar/app") != previous {
+		t.Fatalf("app was updated after the pre-deploy task failed")
+	}
+
+	if server.HasApp("quintoandar/app-pre-deploy") {
+		t.Fatalf("pre-deploy task app was not removed")
+	}
+
+	server.SetBehavior("quintoandar/app-pre-deploy", marathontest.Behavior{
+		Duration: 50 * time.Millisecond,
+		Exit:     "TASK_FINISHED",
+	})
+
+	if _, err := New(client, opts).Deploy(context.Background(), parseApp(t, app)); err != nil {
+		t.Fatalf("Deploy failed: \n%v", err)
+	}
+
+	if server.AppVersion("quintoandar/app") == previous {
+		t.Fatalf("app was not updated after the pre-deploy task finished")
+	}
+
+	if server.HasApp("quintoandar/app-pre-deploy") {
+		t.Fatalf("pre-deploy task app was not removed")
+	}
+}
+
+func TestPreDeployApp(t *testing.T) {
+	task := preDeployApp(parseApp(t, app), "./migrate")
+
+	if task.ID != "quintoandar/app-pre-deploy" || *task.Cmd != "./migrate" || *task.Instances != 1 {
+		t.Fatalf("unexpected pre-deploy task app: \n%+v", task)
+	}
+
+	if task.HealthChecks == nil || len(*task.HealthChecks) != 0 {
+		t.Fatalf("pre-deploy task app has health checks")
+	}
+}
+
+func TestPreDeployAppStripsTaskResources(t *testing.T) {
+	service := parseApp(t, `
+id: quintoandar/db
+constraints: [[hostname, UNIQUE]]
+portDefinitions:
+  - port: 10000
+requirePorts: true
+readinessChecks:
+  - name: ready
+    portName: http
+residency:
+  taskLostBehavior: WAIT_FOREVER
+container:
+  type: DOCKER
+  docker:
+    image: quintoandar/db
+    portMappings:
+      - containerPort: 5432
+        hostPort: 5432
+  volumes:
+    - containerPath: data
+      mode: RW
+      persistent:
+        size: 1024
+    - containerPath: /etc/db
+      hostPath: /etc/db
+      mode: RO
+healthChecks:
+  - protocol: MESOS_TCP
+`)
+
+	task := preDeployApp(service, "./migrate")
+
+	if len(*task.Container.Docker.PortMappings) != 0 || len(*task.PortDefinitions) != 0 || *task.RequirePorts {
+		t.Fatalf("pre-deploy task app has ports: \n%+v", task)
+	}
+
+	if task.Residency != nil || len(*task.Container.Volumes) != 1 || (*task.Container.Volumes)[0].Persistent != nil {
+		t.Fatalf("pre-deploy task app has persistent volumes: \n%+v", task.Container.Volumes)
+	}
+
+	if len(*task.HealthChecks) != 0 || len(*task.ReadinessChecks) != 0 {
+		t.Fatalf("pre-deploy task app has health or readiness checks")
+	}
+
+	if task.Constraints == nil || len(*task.Constraints) != 1 {
+		t.Fatalf("pre-deploy task app lost its constraints")
+	}
+
+	if len(*service.Container.Docker.PortMappings) != 1 || len(*service.Container.Volumes) != 2 {
+		t.Fatalf("the application was modified: \n%+v", service.Container)
+	}
+}
+
+func TestEndToEndExport(t *testing.T) {
+	server, client := newTestServer(t)
+	defer server.Close()
+
+	if _, err := server.AddApp(liveApp); err != nil {
+		t.Fatalf("AddApp failed: \n%v", err)
+	}
+
+	previous := server.AppVersion("quintoandar/app")
+	before, _ := client.Application("quintoandar/app")
+
+	defs, err := Export(client, "quintoandar/app")
+
+	if err != nil || len(defs) != 1 {
+		t.Fatalf("Export failed: %v \n%v", defs, err)
+	}
+
+	data, err := EncodeDefinition(defs[0], false)
+
+	if err != nil {
+		t.Fatalf("EncodeDefinition failed: \n%v", err)
+	}
+
+	if _, err := New(client, Options{Timeout: time.Minute}).Deploy(context.Background(), parseApp(t, data)); err != nil {
+		t.Fatalf("Deploy failed: \n%v", err)
+	}
+
+	after, _ := client.Application("quintoandar/app")
+
+	if after.Version == previous {
+		t.Fatalf("app was not deployed")
+	}
+
+	if params := *after.Container.Docker.Parameters; len(params) != 2 {
+		t.Fatalf("unexpected docker parameters: %v", params)
+	}
+
+	expected, _ := exportApp(before)
+
+	if exported, _ := exportApp(after); !reflect.DeepEqual(exported, expected) {
+		t.Fatalf("deploying the export changed the app: \n%v", exported)
+	}
+}
+
+func TestEndToEndExportGroup(t *testing.T) {
+	server, client := newTestServer(t)
+	defer server.Close()
+
+	addApps(t, server, "quintoandar/jobs/a", "quintoandar/jobs/b")
+
+	defs, err := Export(client, "quintoandar")
+
+	if err != nil || len(defs) != 3 {
+		t.Fatalf("Export failed: %v \n%v", defs, err)
+	}
+
+	dir, err := ioutil.TempDir("", "export")
+
+	if err != nil {
+		t.Fatalf("TempDir failed: \n%v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	files, err := WriteDefinitions(dir, defs, false)
+
+	if err != nil || len(files) != 3 {
+		t.Fatalf("WriteDefinitions failed: %v \n%v", files, err)
+	}
+
+	// every file is a marathonfile of its application
+	for _, id := range []string{"quintoandar/app", "quintoandar/jobs/a", "quintoandar/jobs/b"} {
+		data, err := Input{Marathonfile: filepath.Join(dir, filepath.FromSlash(id+".yaml"))}.Render()
+
+		if err != nil {
+			t.Fatalf("Render failed: \n%v", err)
+		}
+
+		if app := parseApp(t, data); app.ID != "/"+id {
+			t.Fatalf("unexpected application %s in the marathonfile of %s", app.ID, id)
+		}
+	}
+
+	if _, err := Export(client, "missing"); err == nil {
+		t.Fatalf("Export did not fail on a missing application")
+	}
+}
+
+func TestEndToEndExportPods(t *testing.T) {
+	server, client := newTestServer(t)
+	defer server.Close()
+
+	if err := server.AddPod("id: /quintoandar/pods/web"); err != nil {
+		t.Fatalf("AddPod failed: \n%v", err)
+	}
+
+	for _, id := range []string{"quintoandar/pods/web", "quintoandar"} {
+		if _, err := Export(client, id); err == nil || !strings.Contains(err.Error(), "/quintoandar/pods/web") {
+			t.Fatalf("Export of %s did not refuse the pod: %v", id, err)
+		}
+	}
+
+	if _, err := Export(client, "quintoandar/app"); err != nil {
+		t.Fatalf("Export of an application failed: \n%v", err)
+	}
+}
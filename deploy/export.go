@@ -0,0 +1,387 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/ghodss/yaml"
+
+	marathon "github.com/fbcbarbosa/go-marathon"
+)
+
+// managedFields are the application fields Marathon sets on the applications
+// it returns, they are not part of a definition
+var managedFields = []string{
+	"version",
+	"versionInfo",
+	"tasks",
+	"deployments",
+	"lastTaskFailure",
+	"tasksRunning",
+	"tasksStaged",
+	"tasksHealthy",
+	"tasksUnhealthy",
+	"taskStats",
+	"readinessCheckResults",
+	// derived from portDefinitions
+	"ports",
+}
+
+// Values given to the fields left out of a definition, by Marathon or by
+// ApplyDefaults when deploying it
+var (
+	appDefaults = map[string]interface{}{
+		"instances":             1.0,
+		"cpus":                  1.0,
+		"mem":                   128.0,
+		"disk":                  0.0,
+		"gpus":                  0.0,
+		"backoffSeconds":        1.0,
+		"backoffFactor":         1.15,
+		"maxLaunchDelaySeconds": 3600.0,
+		"requirePorts":          false,
+		"killSelection":         "YOUNGEST_FIRST",
+		"upgradeStrategy": map[string]interface{}{
+			"minimumHealthCapacity": 1.0,
+			"maximumOverCapacity":   1.0,
+		},
+		"unreachableStrategy": map[string]interface{}{
+			"inactiveAfterSeconds": 300.0,
+			"expungeAfterSeconds":  600.0,
+		},
+	}
+	healthCheckDefaults = map[string]interface{}{
+		"gracePeriodSeconds":     300.0,
+		"intervalSeconds":        60.0,
+		"timeoutSeconds":         20.0,
+		"maxConsecutiveFailures": 3.0,
+		"delaySeconds":           15.0,
+		"ignoreHttp1xx":          false,
+	}
+	fetchDefaults = map[string]interface{}{
+		"extract":    true,
+		"executable": false,
+		"cache":      false,
+	}
+	dockerDefaults = map[string]interface{}{
+		"privileged":     false,
+		"forcePullImage": false,
+	}
+	portDefaults = map[string]interface{}{
+		"protocol":    "tcp",
+		"servicePort": 0.0,
+		// go-marathon always sends it
+		"hostPort": 0.0,
+	}
+	// parameters added by ApplyDefaults
+	parameterDefaults = []interface{}{
+		map[string]interface{}{"key": "log-driver", "value": "json-file"},
+		map[string]interface{}{"key": "log-opt", "value": "max-size=512m"},
+	}
+)
+
+// Export returns the definition of the application id, or of every
+// application under the group id. The definitions leave out the fields
+// managed by Marathon, the plugin labels and the fields holding the values
+// they default to, so deploying them changes nothing. Pods are refused, the
+// plugin only deploys applications.
+func Export(client Client, id string) ([]map[string]interface{}, error) {
+	app, err := client.Application(id)
+
+	if err == nil {
+		def, err := exportApp(app)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return []map[string]interface{}{def}, nil
+	}
+
+	if !isNotFound(err) {
+		return nil, err
+	}
+
+	pods, err := podsUnder(client, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pods) > 0 {
+		return nil, fmt.Errorf("can not export the pods %s, only applications are supported", strings.Join(pods, ", "))
+	}
+
+	group, err := client.Group(id)
+
+	if err != nil {
+		if isNotFound(err) {
+			return nil, fmt.Errorf("no application or group %s", id)
+		}
+		return nil, err
+	}
+
+	return exportGroup(group)
+}
+
+// podsUnder returns the ids of the pod id or of the pods under the group id
+func podsUnder(client Client, id string) ([]string, error) {
+	pods, err := listPods(client)
+
+	if err != nil {
+		return nil, err
+	}
+
+	id = normalizeID(id)
+	var ids []string
+
+	for _, pod := range pods {
+		if podID := normalizeID(pod.ID); podID == id || underPrefix(podID, id) || id == "/" {
+			ids = append(ids, podID)
+		}
+	}
+
+	return ids, nil
+}
+
+func exportGroup(group *marathon.Group) ([]map[string]interface{}, error) {
+	var defs []map[string]interface{}
+
+	for _, app := range group.Apps {
+		def, err := exportApp(app)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defs = append(defs, def)
+	}
+
+	for _, g := range group.Groups {
+		groupDefs, err := exportGroup(g)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defs = append(defs, groupDefs...)
+	}
+
+	return defs, nil
+}
+
+func exportApp(app *marathon.Application) (map[string]interface{}, error) {
+	b, err := json.Marshal(app)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var def map[string]interface{}
+
+	if err := json.Unmarshal(b, &def); err != nil {
+		return nil, err
+	}
+
+	CleanDefinition(def)
+	return def, nil
+}
+
+// CleanDefinition removes, in place, the fields of an application returned
+// by Marathon that are not worth keeping in a marathonfile, see Export
+func CleanDefinition(def map[string]interface{}) {
+	for _, field := range managedFields {
+		delete(def, field)
+	}
+
+	if _, ok := def["fetch"]; ok {
+		delete(def, "uris")
+	}
+
+	if labels, ok := def["labels"].(map[string]interface{}); ok {
+		delete(labels, LabelExpiresAt)
+		delete(labels, LabelLastDeployed)
+	}
+
+	stripDefaults(def, appDefaults)
+
+	for _, h := range objects(def["healthChecks"]) {
+		stripDefaults(h, healthCheckDefaults)
+
+		if _, ok := h["port"]; !ok && reflect.DeepEqual(h["portIndex"], 0.0) {
+			delete(h, "portIndex")
+		}
+	}
+
+	for _, f := range objects(def["fetch"]) {
+		stripDefaults(f, fetchDefaults)
+	}
+
+	for _, p := range objects(def["portDefinitions"]) {
+		stripDefaults(p, portDefaults)
+	}
+
+	container, _ := def["container"].(map[string]interface{})
+
+	for _, p := range objects(container["portMappings"]) {
+		stripDefaults(p, portDefaults)
+	}
+
+	if docker, ok := container["docker"].(map[string]interface{}); ok {
+		stripDefaults(docker, dockerDefaults)
+
+		for _, p := range objects(docker["portMappings"]) {
+			stripDefaults(p, portDefaults)
+		}
+
+		if params, ok := docker["parameters"].([]interface{}); ok {
+			docker["parameters"] = withoutDefaultParameters(params)
+		}
+	}
+
+	prune(def)
+}
+
+// stripDefaults removes the fields of def holding their default value
+func stripDefaults(def, defaults map[string]interface{}) {
+	for field, value := range defaults {
+		if v, ok := def[field]; ok && reflect.DeepEqual(v, value) {
+			delete(def, field)
+		}
+	}
+}
+
+func withoutDefaultParameters(params []interface{}) []interface{} {
+	kept := []interface{}{}
+
+	for _, p := range params {
+		isDefault := false
+
+		for _, d := range parameterDefaults {
+			if reflect.DeepEqual(p, d) {
+				isDefault = true
+				break
+			}
+		}
+
+		if !isDefault {
+			kept = append(kept, p)
+		}
+	}
+
+	return kept
+}
+
+// objects returns the objects of a list field
+func objects(v interface{}) []map[string]interface{} {
+	list, _ := v.([]interface{})
+	var objects []map[string]interface{}
+
+	for _, e := range list {
+		if o, ok := e.(map[string]interface{}); ok {
+			objects = append(objects, o)
+		}
+	}
+
+	return objects
+}
+
+// prune removes the null and empty fields of def, recursively. The values of
+// env and labels are kept as is, an empty string is meaningful there.
+func prune(def map[string]interface{}) {
+	for field, v := range def {
+		if field != "env" && field != "labels" {
+			pruneValue(v)
+		}
+
+		if isEmpty(v) {
+			delete(def, field)
+		}
+	}
+}
+
+func pruneValue(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		prune(v)
+	case []interface{}:
+		for _, e := range v {
+			pruneValue(e)
+		}
+	}
+}
+
+func isEmpty(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// EncodeDefinition encodes a definition as a YAML or JSON marathonfile
+func EncodeDefinition(def map[string]interface{}, asJSON bool) (string, error) {
+	if asJSON {
+		b, err := json.MarshalIndent(def, "", "  ")
+
+		if err != nil {
+			return "", err
+		}
+
+		return string(b) + "\n", nil
+	}
+
+	b, err := yaml.Marshal(def)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// WriteDefinitions writes each definition as a marathonfile in dir, under
+// the path of its group (quintoandar/jobs/api.yaml), and returns the files
+func WriteDefinitions(dir string, defs []map[string]interface{}, asJSON bool) ([]string, error) {
+	ext := ".yaml"
+
+	if asJSON {
+		ext = ".json"
+	}
+
+	var files []string
+
+	for _, def := range defs {
+		id, _ := def["id"].(string)
+		file := filepath.Join(dir, filepath.FromSlash(strings.Trim(normalizeID(id), "/")+ext))
+
+		data, err := EncodeDefinition(def, asJSON)
+
+		if err != nil {
+			return files, err
+		}
+
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return files, err
+		}
+
+		if err := ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+			return files, err
+		}
+
+		files = append(files, file)
+	}
+
+	return files, nil
+}
@@ -0,0 +1,105 @@
+package deploy
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+var liveApp = `{
+  "id": "/quintoandar/app",
+  "cmd": null,
+  "args": null,
+  "user": null,
+  "env": {"DEBUG": ""},
+  "instances": 1,
+  "cpus": 0.1,
+  "mem": 128,
+  "disk": 0,
+  "gpus": 0,
+  "executor": "",
+  "constraints": [],
+  "uris": [],
+  "fetch": [{"uri": "http://example.com/app.tar.gz", "extract": true, "executable": false, "cache": false}],
+  "storeUrls": [],
+  "backoffSeconds": 1,
+  "backoffFactor": 1.15,
+  "maxLaunchDelaySeconds": 3600,
+  "container": {
+    "type": "DOCKER",
+    "volumes": [],
+    "docker": {
+      "image": "quintoandar/app",
+      "network": "BRIDGE",
+      "portMappings": [{"containerPort": 8080, "hostPort": 0, "servicePort": 10001, "protocol": "tcp", "labels": {}}],
+      "privileged": false,
+      "parameters": [
+        {"key": "log-driver", "value": "json-file"},
+        {"key": "log-opt", "value": "max-size=512m"}
+      ],
+      "forcePullImage": false
+    }
+  },
+  "healthChecks": [{
+    "gracePeriodSeconds": 60,
+    "intervalSeconds": 15,
+    "timeoutSeconds": 10,
+    "maxConsecutiveFailures": 3,
+    "portIndex": 0,
+    "path": "/health",
+    "protocol": "MESOS_HTTP",
+    "delaySeconds": 15
+  }],
+  "readinessChecks": [],
+  "dependencies": [],
+  "upgradeStrategy": {"minimumHealthCapacity": 1, "maximumOverCapacity": 1},
+  "labels": {"drone-marathon/last-deployed": "2017-09-29T15:59:51Z", "HAPROXY_GROUP": "external"},
+  "ipAddress": null,
+  "version": "2017-09-29T15:59:51.164Z",
+  "versionInfo": {"lastScalingAt": "2017-09-29T15:59:51.164Z", "lastConfigChangeAt": "2017-09-29T15:59:51.164Z"},
+  "killSelection": "YOUNGEST_FIRST",
+  "unreachableStrategy": {"inactiveAfterSeconds": 300, "expungeAfterSeconds": 600},
+  "tasksStaged": 0,
+  "tasksRunning": 1,
+  "tasksHealthy": 1,
+  "tasksUnhealthy": 0,
+  "deployments": [],
+  "tasks": [{"id": "quintoandar_app.1", "state": "TASK_RUNNING"}]
+}`
+
+var exportedApp = `{
+  "id": "/quintoandar/app",
+  "env": {"DEBUG": ""},
+  "cpus": 0.1,
+  "fetch": [{"uri": "http://example.com/app.tar.gz"}],
+  "container": {
+    "type": "DOCKER",
+    "docker": {
+      "image": "quintoandar/app",
+      "network": "BRIDGE",
+      "portMappings": [{"containerPort": 8080, "servicePort": 10001}]
+    }
+  },
+  "healthChecks": [{
+    "gracePeriodSeconds": 60,
+    "intervalSeconds": 15,
+    "timeoutSeconds": 10,
+    "path": "/health",
+    "protocol": "MESOS_HTTP"
+  }],
+  "labels": {"HAPROXY_GROUP": "external"}
+}`
+
+func TestCleanDefinition(t *testing.T) {
+	var def, expected map[string]interface{}
+
+	json.Unmarshal([]byte(liveApp), &def)
+	json.Unmarshal([]byte(exportedApp), &expected)
+
+	CleanDefinition(def)
+
+	if !reflect.DeepEqual(def, expected) {
+		b, _ := json.MarshalIndent(def, "", "  ")
+		t.Fatalf("unexpected definition: \n%s", b)
+	}
+}
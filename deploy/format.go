@@ -0,0 +1,223 @@
+package deploy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// placeholder matches the variables substituted when deploying, see
+// Input.Read, escaped ones included
+var placeholder = regexp.MustCompile(`\$?\$\{[^}]*\}`)
+
+// placeholderBase is the first number placeholders are replaced with while
+// formatting, so ones standing for a whole value parse as numbers and the
+// ones inside strings stay in them
+const placeholderBase = 7310000000001
+
+// resourceFields are the numeric fields normalized when formatting
+var resourceFields = []string{"cpus", "mem", "disk", "gpus", "instances"}
+
+// Format returns the canonical YAML form of a YAML or JSON marathonfile or
+// overlay: keys sorted with id first and resource numbers normalized. The
+// ${VAR} placeholders are kept as written. Documents with comments are
+// refused as formatting would drop them.
+func Format(data string) (string, error) {
+	if hasComments(data) {
+		return "", errors.New("the document has comments, which formatting would drop")
+	}
+
+	var vars []string
+
+	masked := placeholder.ReplaceAllStringFunc(data, func(v string) string {
+		vars = append(vars, v)
+		return strconv.Itoa(placeholderBase + len(vars) - 1)
+	})
+
+	for i := range vars {
+		if strings.Count(masked, strconv.Itoa(placeholderBase+i)) != 1 {
+			return "", fmt.Errorf("can not format a document holding %d", placeholderBase+i)
+		}
+	}
+
+	b, err := parseData(masked)
+
+	if err != nil {
+		return "", err
+	}
+
+	var def map[string]interface{}
+
+	if err := json.Unmarshal(b, &def); err != nil {
+		return "", err
+	}
+
+	normalizeResources(def)
+
+	if run, ok := def["run"].(map[string]interface{}); ok {
+		normalizeResources(run)
+	}
+
+	if b, err = json.Marshal(def); err != nil {
+		return "", err
+	}
+
+	// the definition must be valid for the deploy. Whole values standing for
+	// a placeholder are left out, their type is only known once substituted,
+	// and so are the overlay directives.
+	if b, err = json.Marshal(checkable(def, len(vars))); err != nil {
+		return "", err
+	}
+
+	if _, err := Parse(string(b)); err != nil {
+		return "", err
+	}
+
+	out, err := yaml.Marshal(canonical(def))
+
+	if err != nil {
+		return "", err
+	}
+
+	formatted := string(out)
+
+	for i, v := range vars {
+		formatted = strings.Replace(formatted, strconv.Itoa(placeholderBase+i), v, 1)
+	}
+
+	return formatted, nil
+}
+
+// checkable returns a copy of v without the values that are one of the n
+// placeholder numbers and without the list items that are overlay directives
+func checkable(v interface{}, n int) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+
+		for k, e := range v {
+			if !isPlaceholder(e, n) {
+				m[k] = checkable(e, n)
+			}
+		}
+
+		return m
+
+	case []interface{}:
+		list := []interface{}{}
+
+		for _, e := range removeDirectives(v) {
+			if !isPlaceholder(e, n) {
+				list = append(list, checkable(e, n))
+			}
+		}
+
+		return list
+	}
+
+	return v
+}
+
+func isPlaceholder(v interface{}, n int) bool {
+	f, ok := v.(float64)
+	return ok && f >= placeholderBase && f < placeholderBase+float64(n)
+}
+
+// hasComments reports whether a YAML document has comments: a # starting a
+// line or following a blank, outside of quoted scalars. Block scalars holding
+// " #" are reported too.
+func hasComments(data string) bool {
+	for _, line := range strings.Split(data, "\n") {
+		var quote rune
+		escaped := false
+		prev := ' '
+
+		for _, c := range line {
+			switch {
+			case quote == '"' && escaped:
+				escaped = false
+			case quote == '"' && c == '\\':
+				escaped = true
+			case quote != 0:
+				if c == quote {
+					quote = 0
+				}
+			case (c == '"' || c == '\'') && strings.ContainsRune(" \t[{,:", prev):
+				quote = c
+			case c == '#' && (prev == ' ' || prev == '\t'):
+				return true
+			}
+
+			prev = c
+		}
+	}
+
+	return false
+}
+
+// normalizeResources converts the resource fields written as strings to
+// numbers
+func normalizeResources(def map[string]interface{}) {
+	for _, field := range resourceFields {
+		s, ok := def[field].(string)
+
+		if !ok {
+			continue
+		}
+
+		if f, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+			def[field] = f
+		}
+	}
+}
+
+// canonical converts a JSON value to its YAML form with ordered keys, id
+// first, and integral numbers written as integers
+func canonical(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+
+		for k := range v {
+			keys = append(keys, k)
+		}
+
+		sort.Slice(keys, func(i, j int) bool {
+			if keys[i] == "id" || keys[j] == "id" {
+				return keys[i] == "id"
+			}
+			return keys[i] < keys[j]
+		})
+
+		m := yaml.MapSlice{}
+
+		for _, k := range keys {
+			m = append(m, yaml.MapItem{Key: k, Value: canonical(v[k])})
+		}
+
+		return m
+
+	case []interface{}:
+		list := make([]interface{}, len(v))
+
+		for i, e := range v {
+			list[i] = canonical(e)
+		}
+
+		return list
+
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+			return int64(v)
+		}
+	}
+
+	return v
+}
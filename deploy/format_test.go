@@ -0,0 +1,100 @@
+package deploy
+
+import (
+	"testing"
+)
+
+var unformattedApp = `{
+  "mem": "512",
+  "labels": {"team": "core", "HAPROXY_GROUP": "external"},
+  "id": "/quintoandar/app-${DRONE_BRANCH}",
+  "instances": ${INSTANCES},
+  "cpus": 0.10,
+  "disk": 1024.0,
+  "env": {"VERSION": "${DRONE_TAG}", "DEBUG": "false"},
+  "container": {"type": "DOCKER", "docker": {"image": "quintoandar/app:${DRONE_TAG}"}}
+}`
+
+var formattedApp = `id: /quintoandar/app-${DRONE_BRANCH}
+container:
+  docker:
+    image: quintoandar/app:${DRONE_TAG}
+  type: DOCKER
+cpus: 0.1
+disk: 1024
+env:
+  DEBUG: "false"
+  VERSION: "${DRONE_TAG}"
+instances: ${INSTANCES}
+labels:
+  HAPROXY_GROUP: external
+  team: core
+mem: 512
+`
+
+func TestFormat(t *testing.T) {
+	data, err := Format(unformattedApp)
+
+	if err != nil {
+		t.Fatalf("Format failed: \n%v", err)
+	}
+
+	if data != formattedApp {
+		t.Fatalf("unexpected format: \n%s", data)
+	}
+
+	if again, err := Format(data); err != nil || again != data {
+		t.Fatalf("formatted document changed: %v \n%s", err, again)
+	}
+}
+
+func TestFormatInvalid(t *testing.T) {
+	for _, data := range []string{
+		"id: [",
+		"instances: many",
+		"id: app\ncpus: ${CPUS}\nmem: 7310000000001",
+	} {
+		if _, err := Format(data); err == nil {
+			t.Fatalf("Format accepted %q", data)
+		}
+	}
+}
+
+func TestFormatUnquotedPlaceholders(t *testing.T) {
+	data := "id: ${APP_ID}\ninstances: ${INSTANCES}\ncontainer:\n  type: DOCKER\n  docker:\n    image: ${IMAGE}\nenv:\n  TAG: ${DRONE_TAG}\n"
+
+	formatted, err := Format(data)
+
+	if err != nil {
+		t.Fatalf("Format failed: \n%v", err)
+	}
+
+	expected := "id: ${APP_ID}\ncontainer:\n  docker:\n    image: ${IMAGE}\n  type: DOCKER\nenv:\n  TAG: ${DRONE_TAG}\ninstances: ${INSTANCES}\n"
+
+	if formatted != expected {
+		t.Fatalf("unexpected format: \n%s", formatted)
+	}
+}
+
+func TestFormatComments(t *testing.T) {
+	for _, data := range []string{
+		"# the app\nid: app",
+		"id: app # the app",
+		"id: app\ncmd: echo don't # really",
+	} {
+		if _, err := Format(data); err == nil {
+			t.Fatalf("Format accepted comments in %q", data)
+		}
+	}
+
+	for _, data := range []string{
+		"id: app\ncmd: \"echo ' # not a comment\"",
+		"id: app\nlabels: {color: '#fff', url: 'http://example.com/#top'}",
+		"id: app\nfetch:\n  - uri: http://example.com/app.tar.gz#sha",
+		`{"id":"app","cmd":"echo 1 #x"}`,
+	} {
+		if _, err := Format(data); err != nil {
+			t.Fatalf("Format refused %q: \n%v", data, err)
+		}
+	}
+}
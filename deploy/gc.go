@@ -0,0 +1,119 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	marathon "github.com/fbcbarbosa/go-marathon"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Labels set on deploy when Options.TTL is set, GC deletes the apps past them
+const (
+	LabelExpiresAt    = "drone-marathon/expires-at"
+	LabelLastDeployed = "drone-marathon/last-deployed"
+)
+
+// GCOptions configures a GC run
+type GCOptions struct {
+	// TTL expires apps deployed longer ago that have no expires-at label
+	TTL time.Duration
+	// DryRun only logs the apps that would be deleted
+	DryRun bool
+	// MaxDeletions fails the run without deleting anything when more apps
+	// have expired, zero disables the limit
+	MaxDeletions int
+}
+
+// stamp sets the expiry labels on the application
+func stamp(app *marathon.Application, now time.Time, ttl time.Duration) {
+	app.AddLabel(LabelLastDeployed, now.UTC().Format(time.RFC3339))
+	app.AddLabel(LabelExpiresAt, now.Add(ttl).UTC().Format(time.RFC3339))
+}
+
+// expiry returns when the application expires, apps without the expiry
+// labels never expire
+func expiry(app *marathon.Application, ttl time.Duration) (time.Time, bool) {
+	if app.Labels == nil {
+		return time.Time{}, false
+	}
+
+	labels := *app.Labels
+
+	if t, err := time.Parse(time.RFC3339, labels[LabelExpiresAt]); err == nil {
+		return t, true
+	}
+
+	if t, err := time.Parse(time.RFC3339, labels[LabelLastDeployed]); err == nil && ttl > 0 {
+		return t.Add(ttl), true
+	}
+
+	return time.Time{}, false
+}
+
+// GC destroys the applications under Options.DestroyPrefix past their expiry
+// and returns their ids
+func (d *Deployer) GC(c context.Context, opts GCOptions) ([]string, error) {
+	ctx := log.WithFields(log.Fields{
+		"mode":   "gc",
+		"prefix": d.opts.DestroyPrefix,
+	})
+
+	if strings.Trim(d.opts.DestroyPrefix, "/") == "" {
+		err := errors.New("refusing to collect garbage without a destroy prefix")
+		ctx.Error(err)
+		return nil, err
+	}
+
+	apps, err := d.client.Applications(url.Values{"id": []string{normalizeID(d.opts.DestroyPrefix)}})
+
+	if err != nil {
+		ctx.WithError(err).Error("failed to list applications")
+		return nil, err
+	}
+
+	now := time.Now()
+	var expired []string
+
+	for _, app := range apps.Apps {
+		if !underPrefix(app.ID, d.opts.DestroyPrefix) {
+			continue
+		}
+
+		if at, ok := expiry(&app, opts.TTL); ok && now.After(at) {
+			ctx.WithFields(log.Fields{
+				"app":        app.ID,
+				"expired_at": at.Format(time.RFC3339),
+			}).Info("application expired")
+			expired = append(expired, app.ID)
+		}
+	}
+
+	sort.Strings(expired)
+
+	if opts.MaxDeletions > 0 && len(expired) > opts.MaxDeletions {
+		err := fmt.Errorf("%d applications expired, more than the %d deletions allowed", len(expired), opts.MaxDeletions)
+		ctx.Error(err)
+		return expired, err
+	}
+
+	if opts.DryRun {
+		ctx.WithField("expired", len(expired)).Info("dry run, not deleting expired applications")
+		return expired, nil
+	}
+
+	for _, id := range expired {
+		if _, err := d.Destroy(c, id); err != nil {
+			return expired, err
+		}
+	}
+
+	ctx.WithField("deleted", len(expired)).Info("expired applications deleted")
+	return expired, nil
+}
@@ -0,0 +1,77 @@
+package deploy
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDeployStampsExpiry(t *testing.T) {
+	client := newFakeClient(false)
+
+	if _, err := New(client, Options{Timeout: time.Minute, TTL: time.Hour}).
+		Deploy(context.Background(), parseApp(t, app)); err != nil {
+		t.Fatalf("Deploy failed: \n%v", err)
+	}
+
+	at, ok := expiry(client.updated, 0)
+
+	if !ok || at.Before(time.Now().Add(59*time.Minute)) || at.After(time.Now().Add(time.Hour)) {
+		t.Fatalf("unexpected expiry: %v %v", at, client.updated.Labels)
+	}
+}
+
+func TestEndToEndGC(t *testing.T) {
+	server, client := newTestServer(t)
+	defer server.Close()
+
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	deployed := time.Now().Add(-48 * time.Hour).UTC().Format(time.RFC3339)
+
+	for _, definition := range []string{
+		"{id: /previews/1/api, labels: {" + LabelExpiresAt + ": '" + past + "'}}",
+		"{id: /previews/2/api, labels: {" + LabelExpiresAt + ": '" + future + "'}}",
+		"{id: /previews/3/api, labels: {" + LabelLastDeployed + ": '" + deployed + "'}}",
+		"{id: /previews/4/api}",
+		"{id: /production/api, labels: {" + LabelExpiresAt + ": '" + past + "'}}",
+	} {
+		if _, err := server.AddApp(definition); err != nil {
+			t.Fatalf("AddApp failed: \n%v", err)
+		}
+	}
+
+	deployer := New(client, Options{Timeout: time.Minute, DestroyPrefix: "/previews"})
+	expected := []string{"/previews/1/api", "/previews/3/api"}
+
+	expired, err := deployer.GC(context.Background(), GCOptions{TTL: 24 * time.Hour, DryRun: true})
+
+	if err != nil || !reflect.DeepEqual(expired, expected) {
+		t.Fatalf("unexpected dry run: %v %v", expired, err)
+	}
+
+	if _, err := deployer.GC(context.Background(), GCOptions{TTL: 24 * time.Hour, MaxDeletions: 1}); err == nil {
+		t.Fatalf("GC did not enforce the max deletions")
+	}
+
+	if !server.HasApp("/previews/1/api") || !server.HasApp("/previews/3/api") {
+		t.Fatalf("apps were deleted by a dry run or above the max deletions")
+	}
+
+	if _, err := deployer.GC(context.Background(), GCOptions{TTL: 24 * time.Hour}); err != nil {
+		t.Fatalf("GC failed: \n%v", err)
+	}
+
+	for id, exists := range map[string]bool{
+		"/previews/1/api": false,
+		"/previews/2/api": true,
+		"/previews/3/api": false,
+		"/previews/4/api": true,
+		"/production/api": true,
+	} {
+		if server.HasApp(id) != exists {
+			t.Fatalf("unexpected app %s, exists: %v", id, !exists)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package deploy
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+
+	"github.com/drone/envsubst"
+	"github.com/ghodss/yaml"
+
+	marathon "github.com/fbcbarbosa/go-marathon"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Input locates an application definition and how it is rendered
+type Input struct {
+	Marathonfile string
+	// AppConfig is an in-line definition used when there is no Marathonfile
+	AppConfig string
+	// Overlays are merged in order on top of the definition
+	Overlays     []string
+	OverlayMerge string
+	// Template renders every file with text/template first
+	Template bool
+}
+
+// Read reads Marathonfile/Appconfig data, merges overlays and
+// substitutes environment variables
+func (in Input) Read() (data string, err error) {
+	data, err = in.Render()
+
+	if err != nil {
+		return "", err
+	}
+
+	// When 0.9 comes out, limit to secrets and other Drone variables
+	log.Infof("App data: \n%s", data)
+	return envsubst.EvalEnv(data)
+}
+
+// Render returns the Marathonfile/Appconfig data merged with its
+// overlays, before environment variables are substituted
+func (in Input) Render() (string, error) {
+	base, err := in.readBase()
+
+	if err != nil || len(in.Overlays) == 0 {
+		return base, err
+	}
+
+	docs := []string{base}
+
+	for _, overlay := range in.Overlays {
+		log.WithFields(log.Fields{
+			"file": overlay,
+		}).Info("applying overlay")
+
+		doc, err := in.readFile(overlay)
+
+		if err != nil {
+			return "", err
+		}
+
+		docs = append(docs, doc)
+	}
+
+	strategy := in.OverlayMerge
+
+	if strategy == "" {
+		strategy = MergeStrategic
+	}
+
+	return mergeDocuments(strategy, docs...)
+}
+
+func (in Input) readBase() (string, error) {
+	if in.Marathonfile != "" {
+		log.WithFields(log.Fields{
+			"file": in.Marathonfile,
+		}).Info("parsing marathonfile")
+
+		return in.readFile(in.Marathonfile)
+	}
+
+	if in.AppConfig != "" {
+		log.Warn("app_config is deprecated, please use a marathonfile instead")
+		return in.render("app_config", in.AppConfig)
+	}
+
+	return "", errors.New("missing parameters")
+}
+
+func (in Input) readFile(name string) (string, error) {
+	b, err := ioutil.ReadFile(name)
+
+	if err != nil {
+		return "", err
+	}
+
+	return in.render(name, string(b))
+}
+
+// render runs data through the template engine when template mode is enabled
+func (in Input) render(name, data string) (string, error) {
+	if !in.Template {
+		return data, nil
+	}
+
+	log.WithFields(log.Fields{
+		"file": name,
+	}).Info("rendering template")
+
+	return renderTemplate(name, data)
+}
+
+// Parse parses YAML or JSON input data into an application definition
+func Parse(data string) (*marathon.Application, error) {
+	b, err := parseData(data)
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Errorf("failed to parse input data into JSON format")
+		return nil, err
+	}
+
+	if b, err = modelNetworking(b); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("failed to convert the networking configuration")
+		return nil, err
+	}
+
+	var app marathon.Application
+
+	if err := app.UnmarshalJSON(b); err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("failed to unmarshal marathonfile: ", string(b))
+		return nil, err
+	}
+
+	return &app, nil
+}
+
+func parseData(data string) (b []byte, err error) {
+	if isYAML(data) {
+		log.Info("data is in YAML format, parsing into JSON")
+		return yaml.YAMLToJSON([]byte(data))
+	}
+
+	if isJSON(data) {
+		log.Info("data is in JSON format, no need to parse")
+		return
+	}
+
+	err = errors.New("invalid data format")
+	return
+}
+
+func isJSON(s string) bool {
+	var j map[string]interface{}
+	return json.Unmarshal([]byte(s), &j) == nil
+}
+
+func isYAML(s string) bool {
+	var y map[string]interface{}
+	return yaml.Unmarshal([]byte(s), &y) == nil
+}
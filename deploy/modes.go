@@ -0,0 +1,183 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	marathon "github.com/fbcbarbosa/go-marathon"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Scale is a target number of instances, or a change to the current number
+// when Delta is set
+type Scale struct {
+	Instances int
+	Delta     bool
+}
+
+// ParseScale parses an instance count ("5") or a delta ("+2", "-1")
+func ParseScale(value string) (Scale, error) {
+	value = strings.TrimSpace(value)
+	delta := strings.HasPrefix(value, "+") || strings.HasPrefix(value, "-")
+
+	instances, err := strconv.Atoi(value)
+
+	if err != nil {
+		return Scale{}, fmt.Errorf("invalid instances %q, expected a count or a +/- delta", value)
+	}
+
+	if !delta && instances < 0 {
+		return Scale{}, fmt.Errorf("invalid instances %q, the count must not be negative", value)
+	}
+
+	return Scale{Instances: instances, Delta: delta}, nil
+}
+
+// target returns the number of instances to scale to from current
+func (s Scale) target(current int) int {
+	if !s.Delta {
+		return s.Instances
+	}
+
+	if target := current + s.Instances; target > 0 {
+		return target
+	}
+
+	return 0
+}
+
+// Scale changes the number of instances of the application without touching
+// its configuration, waiting for the deployment like Deploy does. The target
+// is checked against the instances limit of Options.Policy.
+func (d *Deployer) Scale(c context.Context, appID string, scale Scale) (*Result, error) {
+	return d.run(c, appID, "scale", func(ctx *log.Entry, app *marathon.Application) (*marathon.DeploymentID, error) {
+		current := 1
+
+		if app.Instances != nil {
+			current = *app.Instances
+		}
+
+		target := scale.target(current)
+		app.Instances = &target
+
+		if d.opts.Policy != nil {
+			if err := d.enforcePolicy(ctx, d.opts.Policy.evaluateInstances(target)); err != nil {
+				return nil, err
+			}
+		}
+
+		ctx.WithFields(log.Fields{
+			"instances": current,
+			"target":    target,
+		}).Info("scaling application")
+
+		return d.client.ScaleApplicationInstances(appID, target, true)
+	})
+}
+
+// Restart does a rolling restart of the application, waiting for the
+// deployment like Deploy does
+func (d *Deployer) Restart(c context.Context, appID string) (*Result, error) {
+	return d.run(c, appID, "restart", func(ctx *log.Entry, app *marathon.Application) (*marathon.DeploymentID, error) {
+		ctx.Info("restarting application")
+		return d.client.RestartApplication(appID, true)
+	})
+}
+
+// starter starts a deployment of the current application
+type starter func(ctx *log.Entry, app *marathon.Application) (*marathon.DeploymentID, error)
+
+// run starts a deployment with start and waits for it to finish
+func (d *Deployer) run(c context.Context, appID, mode string, start starter) (*Result, error) {
+	result := NewResult()
+	err := d.runDeployment(c, appID, mode, start, result)
+	result.Finish(err)
+	d.emit(result.Event(), result, err)
+	return result, err
+}
+
+// runDeployment does not roll failed deployments back as the application
+// configuration is unchanged, nor does it watch for crash loops: the tasks
+// that may crash run the version already deployed
+func (d *Deployer) runDeployment(c context.Context, appID, mode string, start starter, result *Result) error {
+	ctx := log.WithFields(log.Fields{
+		"app":   appID,
+		"mode":  mode,
+		"phase": phasePrepare,
+	})
+
+	result.App = appID
+
+	if d.opts.Status {
+		defer result.collect(d.client)
+	}
+
+	app, err := d.client.Application(appID)
+
+	if err != nil {
+		ctx.WithError(err).Error("failed to get application")
+		return err
+	}
+
+	if err := c.Err(); err != nil {
+		ctx.Warning("interrupted before starting the deployment")
+		return err
+	}
+
+	if d.opts.ResetDelay {
+		d.resetDelay(ctx, appID)
+	}
+
+	timeout := newBudget(d.opts.Deadline).timeout(d.opts.Timeout, 0)
+	dep, err := start(ctx, app)
+
+	if err != nil {
+		ctx.WithError(err).Error("failed to start deployment")
+		return err
+	}
+
+	result.Deployment = dep.DeploymentID
+	result.Version = dep.Version
+	d.emit(EventDeployStarted, result, nil)
+
+	ctx = ctx.WithField("phase", phaseDeploy)
+	begin := time.Now()
+
+	err = waitOnDeployment(c, d.client, dep.DeploymentID, timeout,
+		newProgress(d.client, ctx, app, dep), d.opts.ProgressInterval, nil)
+
+	if err != nil && c.Err() != nil {
+		return d.interrupt(ctx, appID, dep, nil, result)
+	}
+
+	if err != nil {
+		ctx.WithFields(log.Fields{
+			"err":         err,
+			"deployment":  dep.DeploymentID,
+			"duration_ms": durationMS(begin),
+			"timeout":     timeout,
+		}).Error("deployment failed")
+
+		// override Marathon timeout error with a more descriptive error
+		if strings.Contains(err.Error(), "timed out") {
+			err = errors.New(
+				"the deployment did not finish within the maximum timeout," +
+					" please check your application logs",
+			)
+		}
+
+		return err
+	}
+
+	ctx.WithFields(log.Fields{
+		"deployment":  dep.DeploymentID,
+		"duration_ms": durationMS(begin),
+	}).Info("deployment finished successfully")
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package deploy
+
+import (
+	"testing"
+)
+
+func TestParseScale(t *testing.T) {
+	cases := map[string]Scale{
+		"5":  {Instances: 5},
+		"0":  {Instances: 0},
+		"+2": {Instances: 2, Delta: true},
+		"-1": {Instances: -1, Delta: true},
+	}
+
+	for value, expected := range cases {
+		scale, err := ParseScale(value)
+
+		if err != nil || scale != expected {
+			t.Fatalf("ParseScale(%q) = %+v, %v", value, scale, err)
+		}
+	}
+
+	for _, value := range []string{"", "two", "1.5"} {
+		if _, err := ParseScale(value); err == nil {
+			t.Fatalf("ParseScale accepted %q", value)
+		}
+	}
+}
+
+func TestScaleTarget(t *testing.T) {
+	if target := (Scale{Instances: 2, Delta: true}).target(3); target != 5 {
+		t.Fatalf("unexpected target: %d", target)
+	}
+
+	if target := (Scale{Instances: -5, Delta: true}).target(3); target != 0 {
+		t.Fatalf("scaled below zero: %d", target)
+	}
+
+	if target := (Scale{Instances: 1}).target(3); target != 1 {
+		t.Fatalf("unexpected target: %d", target)
+	}
+}
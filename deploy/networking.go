@@ -0,0 +1,383 @@
+package deploy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Networking formats of application definitions
+const (
+	// NetworkingAuto picks the format of the server, see SupportsNetworks
+	NetworkingAuto = "auto"
+	// NetworkingLegacy uses container.docker.network and docker portMappings
+	NetworkingLegacy = "legacy"
+	// NetworkingNetworks uses top-level networks and container portMappings,
+	// introduced by Marathon 1.5
+	NetworkingNetworks = "networks"
+)
+
+// Network modes of the Marathon 1.5 networking format
+const (
+	networkModeBridge    = "container/bridge"
+	networkModeHost      = "host"
+	networkModeContainer = "container"
+)
+
+// SupportsNetworks reports whether a Marathon server version expects the
+// Marathon 1.5 networking format
+func SupportsNetworks(version string) bool {
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+
+	if len(parts) < 2 {
+		return false
+	}
+
+	major, err := strconv.Atoi(parts[0])
+
+	if err != nil {
+		return false
+	}
+
+	minor, err := strconv.Atoi(parts[1])
+
+	if err != nil {
+		return false
+	}
+
+	return major > 1 || major == 1 && minor >= 5
+}
+
+// MigrateNetworking converts an application definition from the legacy
+// networking format to the Marathon 1.5 one, in place. It returns a
+// description of each translation made, none when def has nothing to convert.
+func MigrateNetworking(def map[string]interface{}) ([]string, error) {
+	container, _ := def["container"].(map[string]interface{})
+	docker, _ := container["docker"].(map[string]interface{})
+	ipAddress, _ := def["ipAddress"].(map[string]interface{})
+	network, _ := docker["network"].(string)
+
+	var translations []string
+
+	if network != "" || ipAddress != nil {
+		if _, ok := def["networks"]; ok {
+			return nil, errors.New("the definition mixes the legacy and the new networking formats")
+		}
+
+		if _, ok := ipAddress["discovery"]; ok {
+			return nil, errors.New("ipAddress.discovery can not be migrated, use container portMappings instead")
+		}
+
+		n := map[string]interface{}{}
+
+		switch strings.ToUpper(network) {
+		case "BRIDGE":
+			n["mode"] = networkModeBridge
+		case "HOST":
+			n["mode"] = networkModeHost
+		case "USER", "":
+			n["mode"] = networkModeContainer
+
+			if name, _ := ipAddress["networkName"].(string); name != "" {
+				n["name"] = name
+			}
+
+			if labels, ok := ipAddress["labels"]; ok {
+				n["labels"] = labels
+			}
+		default:
+			return nil, fmt.Errorf("unknown container.docker.network %q", network)
+		}
+
+		def["networks"] = []interface{}{n}
+		delete(docker, "network")
+
+		if ipAddress != nil {
+			delete(def, "ipAddress")
+			translations = append(translations, fmt.Sprintf("moved ipAddress to networks %s", describeNetwork(n)))
+		}
+
+		if network != "" {
+			translations = append(translations, fmt.Sprintf("replaced container.docker.network %s with networks %s",
+				network, describeNetwork(n)))
+		}
+	}
+
+	if mappings, ok := docker["portMappings"]; ok {
+		if _, ok := container["portMappings"]; ok {
+			return nil, errors.New("the definition has both docker and container portMappings")
+		}
+
+		container["portMappings"] = mappings
+		delete(docker, "portMappings")
+		translations = append(translations, "moved container.docker.portMappings to container.portMappings")
+	}
+
+	return translations, nil
+}
+
+// legacyNetworking converts an application definition from the Marathon 1.5
+// networking format to the legacy one, in place, which is the only format
+// go-marathon models. Definitions with several networks can not be converted.
+func legacyNetworking(def map[string]interface{}) ([]string, error) {
+	container, _ := def["container"].(map[string]interface{})
+	docker, _ := container["docker"].(map[string]interface{})
+	networks, _ := def["networks"].([]interface{})
+
+	var translations []string
+
+	if len(networks) > 1 {
+		return nil, errors.New("applications with several networks are not supported")
+	}
+
+	if len(networks) == 1 {
+		n, _ := networks[0].(map[string]interface{})
+		mode, _ := n["mode"].(string)
+
+		switch {
+		case mode == networkModeBridge && docker != nil:
+			docker["network"] = "BRIDGE"
+		case mode == networkModeHost && docker != nil:
+			docker["network"] = "HOST"
+		case mode == networkModeHost:
+		case mode == networkModeContainer:
+			ipAddress := map[string]interface{}{}
+
+			if name, ok := n["name"]; ok {
+				ipAddress["networkName"] = name
+			}
+
+			if labels, ok := n["labels"]; ok {
+				ipAddress["labels"] = labels
+			}
+
+			def["ipAddress"] = ipAddress
+
+			if docker != nil {
+				docker["network"] = "USER"
+			}
+		default:
+			return nil, fmt.Errorf("network mode %q is not supported without a docker container", mode)
+		}
+
+		translations = append(translations, fmt.Sprintf("replaced networks %s with the legacy format", describeNetwork(n)))
+	}
+
+	delete(def, "networks")
+
+	if mappings, ok := container["portMappings"]; ok {
+		if docker == nil {
+			return nil, errors.New("container portMappings are not supported without a docker container")
+		}
+
+		docker["portMappings"] = mappings
+		delete(container, "portMappings")
+		translations = append(translations, "moved container.portMappings to container.docker.portMappings")
+	}
+
+	return translations, nil
+}
+
+// modelNetworking converts a JSON definition using the Marathon 1.5
+// networking format to the legacy one, so go-marathon keeps its networking.
+// NetworkingTransport converts it back when sending it to Marathon 1.5.
+func modelNetworking(b []byte) ([]byte, error) {
+	var def map[string]interface{}
+
+	// invalid definitions are reported when unmarshalling the application
+	if json.Unmarshal(b, &def) != nil {
+		return b, nil
+	}
+
+	translations, err := legacyNetworking(def)
+
+	if err != nil || len(translations) == 0 {
+		return b, err
+	}
+
+	for _, translation := range translations {
+		log.WithField("app", def["id"]).Debug("networking: " + translation)
+	}
+
+	return json.Marshal(def)
+}
+
+func describeNetwork(n map[string]interface{}) string {
+	if name, ok := n["name"]; ok {
+		return fmt.Sprintf("[%v %v]", n["mode"], name)
+	}
+	return fmt.Sprintf("[%v]", n["mode"])
+}
+
+// MigrateDocument converts a YAML or JSON application definition to the
+// Marathon 1.5 networking format, keeping its format. The document is
+// returned as is when there is nothing to convert. The networks created in an
+// overlay replace the ones of the base, which were migrated too or are
+// derived from its legacy network when deploying.
+func MigrateDocument(data string, overlay bool) (string, []string, error) {
+	var def map[string]interface{}
+
+	if err := yaml.Unmarshal([]byte(data), &def); err != nil {
+		return "", nil, err
+	}
+
+	_, hadNetworks := def["networks"]
+	translations, err := MigrateNetworking(def)
+
+	if err != nil || len(translations) == 0 {
+		return data, nil, err
+	}
+
+	if networks, ok := def["networks"].([]interface{}); ok && overlay && !hadNetworks {
+		replace := map[string]interface{}{patchDirective: "replace"}
+		def["networks"] = append([]interface{}{replace}, networks...)
+	}
+
+	var b []byte
+
+	if isJSON(data) {
+		if b, err = json.MarshalIndent(def, "", "  "); err == nil {
+			b = append(b, '\n')
+		}
+	} else {
+		b, err = yaml.Marshal(def)
+	}
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	return string(b), translations, nil
+}
+
+// networkingTransport converts the application definitions sent to Marathon
+// to the Marathon 1.5 networking format, and the ones it returns to the
+// legacy one
+type networkingTransport struct {
+	base http.RoundTripper
+}
+
+// NetworkingTransport wraps base, http.DefaultTransport when nil, so the
+// application definitions sent through it are converted to the Marathon 1.5
+// networking format, see MigrateNetworking, and the ones received to the
+// legacy format go-marathon models
+func NetworkingTransport(base http.RoundTripper) http.RoundTripper {
+	return &networkingTransport{base: base}
+}
+
+func (t *networkingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if req.Method == http.MethodGet &&
+		(strings.Contains(req.URL.Path, "/v2/apps") || strings.Contains(req.URL.Path, "/v2/groups")) {
+		return foldResponse(base.RoundTrip(req))
+	}
+
+	if req.Body == nil || (req.Method != http.MethodPut && req.Method != http.MethodPost) ||
+		!strings.Contains(req.URL.Path, "/v2/apps") {
+		return base.RoundTrip(req)
+	}
+
+	b, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var def map[string]interface{}
+
+	if json.Unmarshal(b, &def) == nil {
+		translations, err := MigrateNetworking(def)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert %v to the Marathon 1.5 networking format: %v", def["id"], err)
+		}
+
+		for _, translation := range translations {
+			log.WithField("app", def["id"]).Info("networking: " + translation)
+		}
+
+		if len(translations) > 0 {
+			if b, err = json.Marshal(def); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	r := *req
+	r.Body = ioutil.NopCloser(bytes.NewReader(b))
+	r.ContentLength = int64(len(b))
+
+	return base.RoundTrip(&r)
+}
+
+// foldResponse converts the application definitions of a successful response
+// to the legacy networking format
+func foldResponse(resp *http.Response, err error) (*http.Response, error) {
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+
+	if json.Unmarshal(b, &v) == nil && foldNetworking(v) {
+		if folded, err := json.Marshal(v); err == nil {
+			b = folded
+		}
+	}
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+	resp.ContentLength = int64(len(b))
+	resp.Header.Del("Content-Length")
+
+	return resp, nil
+}
+
+// foldNetworking converts the applications found in a Marathon response, a
+// single application, an app or apps field or a group tree, to the legacy
+// networking format. It reports whether any was converted.
+func foldNetworking(v interface{}) bool {
+	folded := false
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		translations, err := legacyNetworking(v)
+
+		if err != nil {
+			log.WithField("app", v["id"]).WithError(err).Warning("networking: failed to convert application")
+		}
+
+		folded = len(translations) > 0
+
+		for _, field := range []string{"app", "apps", "groups"} {
+			folded = foldNetworking(v[field]) || folded
+		}
+	case []interface{}:
+		for _, e := range v {
+			folded = foldNetworking(e) || folded
+		}
+	}
+
+	return folded
+}
@@ -0,0 +1,181 @@
+package deploy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+)
+
+var legacyApp = `
+id: quintoandar/app
+container:
+  type: DOCKER
+  docker:
+    image: quintoandar/app
+    network: BRIDGE
+    portMappings:
+      - containerPort: 8080
+`
+
+var networksApp = `
+id: quintoandar/app
+container:
+  type: DOCKER
+  docker:
+    image: quintoandar/app
+  portMappings:
+    - containerPort: 8080
+networks:
+  - mode: container/bridge
+`
+
+func parseDefinition(t *testing.T, data string) map[string]interface{} {
+	var def map[string]interface{}
+
+	if err := yaml.Unmarshal([]byte(data), &def); err != nil {
+		t.Fatalf("failed to parse definition: \n%v", err)
+	}
+
+	return def
+}
+
+func TestMigrateNetworking(t *testing.T) {
+	tests := []struct {
+		legacy   string
+		networks string
+	}{
+		{legacyApp, networksApp},
+		{
+			"container: {docker: {image: app, network: HOST}}",
+			"container: {docker: {image: app}}\nnetworks: [{mode: host}]",
+		},
+		{
+			"container: {docker: {image: app, network: USER}}\nipAddress: {networkName: dcos, labels: {a: b}}",
+			"container: {docker: {image: app}}\nnetworks: [{mode: container, name: dcos, labels: {a: b}}]",
+		},
+		{
+			"cmd: sleep 1\nipAddress: {networkName: dcos}",
+			"cmd: sleep 1\nnetworks: [{mode: container, name: dcos}]",
+		},
+		{networksApp, networksApp},
+	}
+
+	for _, test := range tests {
+		def := parseDefinition(t, test.legacy)
+
+		if _, err := MigrateNetworking(def); err != nil {
+			t.Fatalf("MigrateNetworking failed: \n%v", err)
+		}
+
+		if expected := parseDefinition(t, test.networks); !reflect.DeepEqual(def, expected) {
+			t.Fatalf("unexpected migration of %q: \n%v", test.legacy, def)
+		}
+	}
+}
+
+func TestMigrateNetworkingInvalid(t *testing.T) {
+	for _, data := range []string{
+		"container: {docker: {network: BRIDGE}}\nnetworks: [{mode: host}]",
+		"container: {docker: {network: OVERLAY}}",
+		"ipAddress: {discovery: {ports: [{number: 80}]}}",
+	} {
+		if _, err := MigrateNetworking(parseDefinition(t, data)); err == nil {
+			t.Fatalf("MigrateNetworking accepted %q", data)
+		}
+	}
+}
+
+func TestParseNetworks(t *testing.T) {
+	app := parseApp(t, networksApp)
+
+	if app.Container.Docker.Network != "BRIDGE" || app.Container.Docker.PortMappings == nil ||
+		(*app.Container.Docker.PortMappings)[0].ContainerPort != 8080 {
+		t.Fatalf("networking was not kept: \n%+v", app.Container.Docker)
+	}
+
+	if _, err := Parse(networksApp + "  - mode: host\n"); err == nil {
+		t.Fatalf("Parse accepted several networks")
+	}
+}
+
+func TestMigrateDocument(t *testing.T) {
+	data, translations, err := MigrateDocument(`{"id": "app", "container": {"docker": {"network": "HOST"}}}`, false)
+
+	if err != nil {
+		t.Fatalf("MigrateDocument failed: \n%v", err)
+	}
+
+	if len(translations) != 1 || !isJSON(data) || !strings.Contains(data, `"mode": "host"`) {
+		t.Fatalf("unexpected migration %v: \n%s", translations, data)
+	}
+
+	if data, translations, _ := MigrateDocument(networksApp, false); data != networksApp || len(translations) != 0 {
+		t.Fatalf("migrated document was changed: \n%s", data)
+	}
+}
+
+func TestNetworkingTransport(t *testing.T) {
+	var received map[string]interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(b, &received)
+	}))
+	defer server.Close()
+
+	b, _ := yaml.YAMLToJSON([]byte(legacyApp))
+	client := &http.Client{Transport: NetworkingTransport(nil)}
+
+	req, _ := http.NewRequest(http.MethodPut, server.URL+"/v2/apps/quintoandar/app", strings.NewReader(string(b)))
+
+	if _, err := client.Do(req); err != nil {
+		t.Fatalf("request failed: \n%v", err)
+	}
+
+	if expected := parseDefinition(t, networksApp); !reflect.DeepEqual(received, expected) {
+		t.Fatalf("definition was not migrated: \n%v", received)
+	}
+}
+
+func TestNetworkingTransportResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := yaml.YAMLToJSON([]byte(networksApp))
+		w.Write([]byte(`{"app": ` + string(b) + `}`))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NetworkingTransport(nil)}
+	resp, err := client.Get(server.URL + "/v2/apps/quintoandar/app")
+
+	if err != nil {
+		t.Fatalf("request failed: \n%v", err)
+	}
+
+	var received map[string]map[string]interface{}
+	b, _ := ioutil.ReadAll(resp.Body)
+	json.Unmarshal(b, &received)
+
+	if expected := parseDefinition(t, legacyApp); !reflect.DeepEqual(received["app"], expected) {
+		t.Fatalf("definition was not converted: \n%s", b)
+	}
+}
+
+func TestSupportsNetworks(t *testing.T) {
+	for version, expected := range map[string]bool{
+		"1.4.8":  false,
+		"1.5.0":  true,
+		"1.10.1": true,
+		"2.0":    true,
+		"":       false,
+	} {
+		if SupportsNetworks(version) != expected {
+			t.Fatalf("unexpected support for version %q", version)
+		}
+	}
+}
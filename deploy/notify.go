@@ -0,0 +1,155 @@
+package deploy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Deploy lifecycle events sent to webhooks
+const (
+	EventDeployStarted     = "deploy_started"
+	EventDeploySucceeded   = "deploy_succeeded"
+	EventDeployFailed      = "deploy_failed"
+	EventRollbackStarted   = "rollback_started"
+	EventRollbackSucceeded = "rollback_succeeded"
+	EventRollbackFailed    = "rollback_failed"
+)
+
+// Webhook payload formats
+const (
+	FormatJSON  = "json"
+	FormatSlack = "slack"
+)
+
+// Event is the generic JSON webhook payload
+type Event struct {
+	Event           string    `json:"event"`
+	App             string    `json:"app,omitempty"`
+	Deployment      string    `json:"deployment,omitempty"`
+	Version         string    `json:"version,omitempty"`
+	PreviousVersion string    `json:"previousVersion,omitempty"`
+	Error           string    `json:"error,omitempty"`
+	Build           string    `json:"build,omitempty"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// Webhooks posts deploy lifecycle events to a list of URLs
+type Webhooks struct {
+	URLs   []string
+	Format string
+}
+
+// Notify posts the event to every webhook, it can be used as
+// Options.OnEvent. Failing to notify is logged but never fails the deploy.
+func (w Webhooks) Notify(event string, result *Result, err error) {
+	if len(w.URLs) == 0 {
+		return
+	}
+
+	e := Event{
+		Event:           event,
+		App:             result.App,
+		Deployment:      result.Deployment,
+		Version:         result.Version,
+		PreviousVersion: result.PreviousVersion,
+		Build:           os.Getenv("DRONE_BUILD_LINK"),
+		Timestamp:       time.Now().UTC(),
+	}
+
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	var payload interface{} = e
+
+	if w.Format == FormatSlack {
+		payload = slackPayload(e)
+	}
+
+	b, jerr := json.Marshal(payload)
+
+	if jerr != nil {
+		log.WithError(jerr).Warning("failed to encode webhook payload")
+		return
+	}
+
+	for _, url := range w.URLs {
+		if werr := postWebhook(url, b); werr != nil {
+			log.WithFields(log.Fields{
+				"err":   werr,
+				"event": event,
+			}).Warning("failed to notify webhook")
+		}
+	}
+}
+
+func postWebhook(url string, payload []byte) error {
+	resp, err := webhookClient.Post(url, "application/json", bytes.NewReader(payload))
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+
+	return nil
+}
+
+var slackEvents = map[string]struct {
+	color string
+	text  string
+}{
+	EventDeployStarted:     {"#439fe0", "deploy of `%s` started"},
+	EventDeploySucceeded:   {"good", "deploy of `%s` succeeded"},
+	EventDeployFailed:      {"danger", "deploy of `%s` failed"},
+	EventRollbackStarted:   {"warning", "rolling back `%s`"},
+	EventRollbackSucceeded: {"warning", "`%s` was rolled back to its previous version"},
+	EventRollbackFailed:    {"danger", "rollback of `%s` failed, the application is at an unknown state"},
+}
+
+// slackPayload formats the event as a Slack-compatible incoming webhook message
+func slackPayload(e Event) map[string]interface{} {
+	style := slackEvents[e.Event]
+
+	var fields []map[string]interface{}
+
+	add := func(title, value string) {
+		if value != "" {
+			fields = append(fields, map[string]interface{}{
+				"title": title,
+				"value": value,
+				"short": len(value) < 40,
+			})
+		}
+	}
+
+	add("Deployment", e.Deployment)
+	add("Version", e.Version)
+	add("Previous version", e.PreviousVersion)
+	add("Build", e.Build)
+	add("Error", e.Error)
+
+	return map[string]interface{}{
+		"attachments": []map[string]interface{}{
+			{
+				"fallback": fmt.Sprintf(style.text, e.App),
+				"text":     fmt.Sprintf(style.text, e.App),
+				"color":    style.color,
+				"fields":   fields,
+				"ts":       e.Timestamp.Unix(),
+			},
+		},
+	}
+}
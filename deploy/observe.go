@@ -0,0 +1,228 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	marathon "github.com/fbcbarbosa/go-marathon"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// observation watches a deployed application for degradation, comparing its
+// tasks with the ones running when the deployment finished
+type observation struct {
+	client     Client
+	ctx        *log.Entry
+	app        string
+	minHealthy int
+	checks     bool
+	// tasks holds the ids of the tasks running once deployed
+	tasks map[string]bool
+	// failure is the last task failure seen before observing, if any
+	failure string
+}
+
+// observe watches the deployed application for Options.ObserveWindow and
+// redeploys the previous version when it degrades
+func (d *Deployer) observe(c context.Context, ctx *log.Entry, remaining budget, app *marathon.Application,
+	dep *marathon.DeploymentID, prevVersion *marathon.ApplicationVersion, result *Result) error {
+
+	ctx = ctx.WithField("phase", phaseObserve)
+	start := time.Now()
+
+	o, err := d.newObservation(ctx, app)
+
+	if err != nil {
+		ctx.WithError(err).Error("failed to start observing the application")
+		return err
+	}
+
+	ctx.WithFields(log.Fields{
+		"min_healthy": o.minHealthy,
+		"version":     dep.Version,
+		"window":      d.opts.ObserveWindow,
+	}).Info("observing application")
+
+	err = o.watch(c, d.opts.ObserveWindow)
+
+	if err == nil {
+		ctx.WithFields(log.Fields{
+			"duration_ms": durationMS(start),
+			"version":     dep.Version,
+		}).Info("application stayed healthy during the observation window")
+		return nil
+	}
+
+	rollback := d.opts.Rollback
+
+	if c.Err() != nil {
+		ctx.WithField("action", d.opts.OnCancel).Warning("observation interrupted")
+
+		if d.opts.OnCancel != CancelRollback {
+			ctx.WithField("version", dep.Version).Warning("leaving the deployed version running")
+			return errors.New("deploy interrupted")
+		}
+
+		var cancel context.CancelFunc
+		c, cancel = context.WithTimeout(context.Background(), d.opts.CancelGrace)
+		defer cancel()
+
+		err, rollback, remaining = errors.New("deploy interrupted"), true, budget{}
+	} else {
+		ctx.WithFields(log.Fields{
+			"err":         err,
+			"duration_ms": durationMS(start),
+			"version":     dep.Version,
+		}).Error("application degraded during the observation window")
+	}
+
+	if !rollback {
+		ctx.WithField("version", dep.Version).Warning("rollback is not enabled")
+		return err
+	}
+
+	result.Outcome = OutcomeRollbackFailed
+	d.emit(EventDeployFailed, result, err)
+	d.emit(EventRollbackStarted, result, nil)
+
+	ctx = ctx.WithField("phase", phaseRollback)
+
+	if prevVersion == nil {
+		err := errors.New("no previous version available to roll back to")
+		ctx.Error(err)
+		return err
+	}
+
+	if rerr := d.revert(c, ctx, time.Now(), remaining, app.ID, dep, prevVersion, result); rerr != nil {
+		err = fmt.Errorf("%v, and the rollback failed: %v", err, rerr)
+	}
+
+	return err
+}
+
+func (d *Deployer) newObservation(ctx *log.Entry, app *marathon.Application) (*observation, error) {
+	minHealthy := d.opts.ObserveMinHealthy
+
+	if minHealthy <= 0 {
+		minHealthy = 1
+
+		if app.Instances != nil {
+			minHealthy = *app.Instances
+		}
+	}
+
+	o := &observation{
+		client:     d.client,
+		ctx:        ctx,
+		app:        app.ID,
+		minHealthy: minHealthy,
+		checks:     app.HasHealthChecks(),
+		tasks:      map[string]bool{},
+	}
+
+	current, err := d.client.Application(app.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if f := current.LastTaskFailure; f != nil {
+		o.failure = f.TaskID
+	}
+
+	tasks, err := d.client.Tasks(app.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range tasks.Tasks {
+		o.tasks[t.ID] = true
+	}
+
+	return o, nil
+}
+
+// watch checks the application until the window passes, returning the
+// first degradation found
+func (o *observation) watch(c context.Context, window time.Duration) error {
+	tick := time.NewTicker(taskPollInterval)
+	defer tick.Stop()
+	done := time.After(window)
+
+	for {
+		select {
+
+		case <-tick.C:
+
+			if err := o.check(); err != nil {
+				return err
+			}
+
+		case <-done:
+			return o.check()
+
+		case <-c.Done():
+			return c.Err()
+		}
+	}
+}
+
+// check returns an error when a task failed, was killed or restarted, or
+// fails its health checks, or when too few tasks are healthy. Failing to get
+// the application only skips the check.
+func (o *observation) check() error {
+	app, err := o.client.Application(o.app)
+
+	if err != nil {
+		o.ctx.WithError(err).Warning("failed to check the application")
+		return nil
+	}
+
+	if f := app.LastTaskFailure; f != nil && f.TaskID != o.failure {
+		return fmt.Errorf("task %s exited with %s: %s", f.TaskID, f.State, f.Message)
+	}
+
+	tasks, err := o.client.Tasks(o.app)
+
+	if err != nil {
+		o.ctx.WithError(err).Warning("failed to check the application tasks")
+		return nil
+	}
+
+	live := map[string]bool{}
+	healthy := 0
+
+	for _, t := range tasks.Tasks {
+		live[t.ID] = true
+
+		if !o.tasks[t.ID] {
+			return fmt.Errorf("task %s was launched after the deployment, replacing a killed or restarted task", t.ID)
+		}
+
+		for _, h := range t.HealthCheckResults {
+			if h != nil && !h.Alive {
+				return fmt.Errorf("task %s is failing its health checks", t.ID)
+			}
+		}
+
+		if t.State == "TASK_RUNNING" && (!o.checks || isHealthy(t)) {
+			healthy++
+		}
+	}
+
+	for id := range o.tasks {
+		if !live[id] {
+			return fmt.Errorf("task %s was killed", id)
+		}
+	}
+
+	if healthy < o.minHealthy {
+		return fmt.Errorf("%d tasks are healthy, below the minimum of %d", healthy, o.minHealthy)
+	}
+
+	return nil
+}
@@ -0,0 +1,218 @@
+package deploy
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	// MergeStrategic merges overlays recursively and matches list items by
+	// their merge keys (see mergeKeys)
+	MergeStrategic = "strategic"
+	// MergePatch follows JSON merge-patch (RFC 7396) semantics, lists are
+	// always replaced by the overlay
+	MergePatch = "merge-patch"
+)
+
+// patchDirective is the key used by strategic overlays to remove a list item,
+// with the value "delete", or to replace the whole list of the base, as an
+// item of its own holding only "replace"
+const patchDirective = "$patch"
+
+// mergeKeys lists, for each list field of an application definition, the item
+// fields used to match overlay entries against base entries. An overlay item
+// matches a base item when every merge key set in the overlay item has the
+// same value in the base item. Lists without merge keys are replaced.
+var mergeKeys = map[string][]string{
+	"healthChecks":    {"protocol", "path", "portIndex", "port", "command"},
+	"readinessChecks": {"name"},
+	"portMappings":    {"name", "containerPort"},
+	"portDefinitions": {"name", "port"},
+	"fetch":           {"uri"},
+	"volumes":         {"containerPath"},
+	"networks":        {"name", "mode"},
+}
+
+// mergeDocuments merges a list of YAML/JSON documents, in order, into a
+// single YAML document
+func mergeDocuments(strategy string, docs ...string) (string, error) {
+	if strategy != MergeStrategic && strategy != MergePatch {
+		return "", fmt.Errorf("invalid overlay merge strategy %q", strategy)
+	}
+
+	var merged interface{}
+
+	for i, doc := range docs {
+		var v interface{}
+
+		if err := yaml.Unmarshal([]byte(doc), &v); err != nil {
+			return "", fmt.Errorf("failed to parse document %d: %v", i, err)
+		}
+
+		if i == 0 {
+			merged = v
+			continue
+		}
+
+		merged = mergeValue("", merged, v, strategy)
+	}
+
+	if _, ok := merged.(map[string]interface{}); !ok {
+		return "", errors.New("merged document is not an object")
+	}
+
+	b, err := yaml.Marshal(merged)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// mergeValue applies patch on top of base, key is the name of the field
+// holding both values and is used to look up list merge keys
+func mergeValue(key string, base, patch interface{}, strategy string) interface{} {
+	switch p := patch.(type) {
+	case map[string]interface{}:
+		b, ok := base.(map[string]interface{})
+
+		if !ok {
+			b = map[string]interface{}{}
+		}
+
+		return mergeMap(b, p, strategy)
+
+	case []interface{}:
+		b, ok := base.([]interface{})
+		keys, keyed := mergeKeys[key]
+
+		if !ok || !keyed || strategy != MergeStrategic || replacesList(p) {
+			return removeDirectives(p)
+		}
+
+		return mergeList(b, p, keys, strategy)
+	}
+
+	return patch
+}
+
+func mergeMap(base, patch map[string]interface{}, strategy string) map[string]interface{} {
+	out := make(map[string]interface{}, len(base))
+
+	for k, v := range base {
+		out[k] = v
+	}
+
+	for k, v := range patch {
+		// null removes the field, as in JSON merge-patch
+		if v == nil {
+			delete(out, k)
+			continue
+		}
+		out[k] = mergeValue(k, out[k], v, strategy)
+	}
+
+	return out
+}
+
+func mergeList(base, patch []interface{}, keys []string, strategy string) []interface{} {
+	out := make([]interface{}, len(base))
+	copy(out, base)
+
+	for _, item := range patch {
+		m, ok := item.(map[string]interface{})
+
+		if !ok {
+			out = append(out, item)
+			continue
+		}
+
+		i := matchItem(out, m, keys)
+
+		if isDirective(m, "delete") {
+			if i >= 0 {
+				out = append(out[:i], out[i+1:]...)
+			}
+			continue
+		}
+
+		if i < 0 {
+			out = append(out, mergeMap(map[string]interface{}{}, m, strategy))
+			continue
+		}
+
+		out[i] = mergeValue("", out[i], m, strategy)
+	}
+
+	return out
+}
+
+// matchItem returns the index of the first item in list matching patch by
+// keys, or -1 if there is none
+func matchItem(list []interface{}, patch map[string]interface{}, keys []string) int {
+	for i, item := range list {
+		m, ok := item.(map[string]interface{})
+
+		if !ok {
+			continue
+		}
+
+		matched := false
+
+		for _, k := range keys {
+			v, ok := patch[k]
+
+			if !ok {
+				continue
+			}
+
+			if !reflect.DeepEqual(m[k], v) {
+				matched = false
+				break
+			}
+
+			matched = true
+		}
+
+		if matched {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// replacesList reports whether the overlay list holds the replace directive
+func replacesList(list []interface{}) bool {
+	for _, item := range list {
+		if isDirective(item, "replace") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// removeDirectives drops the directive items from lists that are not merged
+// by key, so they never reach Marathon
+func removeDirectives(list []interface{}) []interface{} {
+	out := make([]interface{}, 0, len(list))
+
+	for _, item := range list {
+		if isDirective(item, "delete") || isDirective(item, "replace") {
+			continue
+		}
+		out = append(out, item)
+	}
+
+	return out
+}
+
+func isDirective(item interface{}, directive string) bool {
+	m, ok := item.(map[string]interface{})
+	return ok && m[patchDirective] == directive
+}
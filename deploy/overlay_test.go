@@ -0,0 +1,202 @@
+package deploy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ghodss/yaml"
+)
+
+var appOverlay = `
+cpus: 1
+instances: ${INSTANCES}
+env:
+  LOG_LEVEL: warn
+  DEBUG: null
+container:
+  docker:
+    portMappings:
+      - containerPort: 8080
+        hostPort: 0
+        servicePort: 10101
+      - containerPort: 9090
+healthChecks:
+  - path: /health
+    intervalSeconds: 5
+  - path: /ready
+    protocol: MESOS_HTTP
+`
+
+var appBase = `
+id: quintoandar/app
+cpus: 0.1
+env:
+  LOG_LEVEL: info
+  DEBUG: "true"
+container:
+  type: DOCKER
+  docker:
+    image: quintoandar/app
+    portMappings:
+      - containerPort: 8080
+healthChecks:
+  - protocol: MESOS_HTTP
+    path: /health
+  - protocol: MESOS_TCP
+`
+
+func TestMergeDocumentsStrategic(t *testing.T) {
+	merged, err := mergeDocuments(MergeStrategic, appBase, appOverlay)
+
+	if err != nil {
+		t.Fatalf("mergeDocuments failed: \n%v", err)
+	}
+
+	expected := `
+id: quintoandar/app
+cpus: 1
+instances: ${INSTANCES}
+env:
+  LOG_LEVEL: warn
+container:
+  type: DOCKER
+  docker:
+    image: quintoandar/app
+    portMappings:
+      - containerPort: 8080
+        hostPort: 0
+        servicePort: 10101
+      - containerPort: 9090
+healthChecks:
+  - protocol: MESOS_HTTP
+    path: /health
+    intervalSeconds: 5
+  - protocol: MESOS_TCP
+  - protocol: MESOS_HTTP
+    path: /ready
+`
+
+	assertSameDocument(t, expected, merged)
+}
+
+func TestMergeDocumentsMergePatch(t *testing.T) {
+	merged, err := mergeDocuments(MergePatch, appBase, appOverlay)
+
+	if err != nil {
+		t.Fatalf("mergeDocuments failed: \n%v", err)
+	}
+
+	expected := `
+id: quintoandar/app
+cpus: 1
+instances: ${INSTANCES}
+env:
+  LOG_LEVEL: warn
+container:
+  type: DOCKER
+  docker:
+    image: quintoandar/app
+    portMappings:
+      - containerPort: 8080
+        hostPort: 0
+        servicePort: 10101
+      - containerPort: 9090
+healthChecks:
+  - path: /health
+    intervalSeconds: 5
+  - path: /ready
+    protocol: MESOS_HTTP
+`
+
+	assertSameDocument(t, expected, merged)
+}
+
+func TestMergeDocumentsDeleteDirective(t *testing.T) {
+	overlay := `
+healthChecks:
+  - path: /health
+    $patch: delete
+`
+
+	merged, err := mergeDocuments(MergeStrategic, appBase, overlay)
+
+	if err != nil {
+		t.Fatalf("mergeDocuments failed: \n%v", err)
+	}
+
+	expected := `
+id: quintoandar/app
+cpus: 0.1
+env:
+  LOG_LEVEL: info
+  DEBUG: "true"
+container:
+  type: DOCKER
+  docker:
+    image: quintoandar/app
+    portMappings:
+      - containerPort: 8080
+healthChecks:
+  - protocol: MESOS_TCP
+`
+
+	assertSameDocument(t, expected, merged)
+}
+
+func TestMergeDocumentsReplaceDirective(t *testing.T) {
+	overlay := `
+healthChecks:
+  - $patch: replace
+  - protocol: COMMAND
+    command:
+      value: true
+`
+
+	merged, err := mergeDocuments(MergeStrategic, appBase, overlay)
+
+	if err != nil {
+		t.Fatalf("mergeDocuments failed: \n%v", err)
+	}
+
+	expected := `
+id: quintoandar/app
+cpus: 0.1
+env:
+  LOG_LEVEL: info
+  DEBUG: "true"
+container:
+  type: DOCKER
+  docker:
+    image: quintoandar/app
+    portMappings:
+      - containerPort: 8080
+healthChecks:
+  - protocol: COMMAND
+    command:
+      value: true
+`
+
+	assertSameDocument(t, expected, merged)
+}
+
+func TestMergeDocumentsInvalidStrategy(t *testing.T) {
+	if _, err := mergeDocuments("replace", appBase, appOverlay); err == nil {
+		t.Fatalf("mergeDocuments did not fail")
+	}
+}
+
+func assertSameDocument(t *testing.T, expected, actual string) {
+	var e, a interface{}
+
+	if err := yaml.Unmarshal([]byte(expected), &e); err != nil {
+		t.Fatalf("invalid expected document: \n%v", err)
+	}
+
+	if err := yaml.Unmarshal([]byte(actual), &a); err != nil {
+		t.Fatalf("invalid merged document: \n%v", err)
+	}
+
+	if !reflect.DeepEqual(e, a) {
+		t.Fatalf("unexpected merged document: \n%s", actual)
+	}
+}
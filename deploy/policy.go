@@ -0,0 +1,197 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+
+	marathon "github.com/fbcbarbosa/go-marathon"
+)
+
+const (
+	// PolicyEnforce fails the deploy when the application violates the policy
+	PolicyEnforce = "enforce"
+	// PolicyWarn only logs policy violations
+	PolicyWarn = "warn"
+)
+
+// Policy defines the platform guardrails an application must comply with
+// before it is deployed, zero values disable the corresponding rule
+type Policy struct {
+	MaxCPUs             float64  `json:"maxCpus,omitempty"`
+	MaxMem              float64  `json:"maxMem,omitempty"`
+	MaxInstances        int      `json:"maxInstances,omitempty"`
+	ForbidLatestTag     bool     `json:"forbidLatestTag,omitempty"`
+	RequireHealthChecks bool     `json:"requireHealthChecks,omitempty"`
+	RequiredLabels      []string `json:"requiredLabels,omitempty"`
+	ForbidPrivileged    bool     `json:"forbidPrivileged,omitempty"`
+	ForbidHostNetwork   bool     `json:"forbidHostNetwork,omitempty"`
+	// AllowedConstraints lists approved constraint prefixes, e.g.
+	// ["hostname", "UNIQUE"] or ["zone", "GROUP_BY"]
+	AllowedConstraints [][]string `json:"allowedConstraints,omitempty"`
+}
+
+// PolicyViolations is the error returned when an application violates a Policy
+type PolicyViolations []string
+
+func (v PolicyViolations) Error() string {
+	return fmt.Sprintf("application violates the deploy policy:\n - %s",
+		strings.Join(v, "\n - "))
+}
+
+// LoadPolicy reads a YAML or JSON policy file. Unknown rules are refused, a
+// misspelled rule would otherwise be silently disabled.
+func LoadPolicy(file string) (*Policy, error) {
+	b, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if b, err = yaml.YAMLToJSON(b); err != nil {
+		return nil, err
+	}
+
+	var rules map[string]interface{}
+
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %v", file, err)
+	}
+
+	if unknown := unknownRules(rules); len(unknown) > 0 {
+		return nil, fmt.Errorf("invalid policy %s: unknown rules %s", file, strings.Join(unknown, ", "))
+	}
+
+	var policy Policy
+
+	if err := json.Unmarshal(b, &policy); err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %v", file, err)
+	}
+
+	return &policy, nil
+}
+
+// unknownRules returns the sorted keys of rules that are not Policy fields
+func unknownRules(rules map[string]interface{}) []string {
+	known := map[string]bool{}
+	t := reflect.TypeOf(Policy{})
+
+	for i := 0; i < t.NumField(); i++ {
+		known[strings.Split(t.Field(i).Tag.Get("json"), ",")[0]] = true
+	}
+
+	var unknown []string
+
+	for rule := range rules {
+		if !known[rule] {
+			unknown = append(unknown, rule)
+		}
+	}
+
+	sort.Strings(unknown)
+	return unknown
+}
+
+// Evaluate returns every rule the application violates
+func (p *Policy) Evaluate(app *marathon.Application) PolicyViolations {
+	var v PolicyViolations
+
+	if p.MaxCPUs > 0 && app.CPUs > p.MaxCPUs {
+		v = append(v, fmt.Sprintf("cpus %v exceeds the maximum of %v", app.CPUs, p.MaxCPUs))
+	}
+
+	if p.MaxMem > 0 && app.Mem != nil && *app.Mem > p.MaxMem {
+		v = append(v, fmt.Sprintf("mem %v exceeds the maximum of %v", *app.Mem, p.MaxMem))
+	}
+
+	if app.Instances != nil {
+		v = append(v, p.evaluateInstances(*app.Instances)...)
+	}
+
+	if p.RequireHealthChecks && (app.HealthChecks == nil || len(*app.HealthChecks) == 0) {
+		v = append(v, "healthChecks are required")
+	}
+
+	for _, label := range p.RequiredLabels {
+		if app.Labels == nil || (*app.Labels)[label] == "" {
+			v = append(v, fmt.Sprintf("label %q is required", label))
+		}
+	}
+
+	if app.Container != nil && app.Container.Docker != nil {
+		docker := app.Container.Docker
+
+		if p.ForbidLatestTag && isLatestTag(docker.Image) {
+			v = append(v, fmt.Sprintf("image %q must be pinned to a tag other than latest", docker.Image))
+		}
+
+		if p.ForbidPrivileged && docker.Privileged != nil && *docker.Privileged {
+			v = append(v, "privileged docker containers are forbidden")
+		}
+
+		// marathonfiles in the networks format are parsed to the legacy
+		// one, networks: [{mode: host}] included
+		if p.ForbidHostNetwork && strings.EqualFold(docker.Network, "HOST") {
+			v = append(v, "HOST networking is forbidden")
+		}
+	}
+
+	if len(p.AllowedConstraints) > 0 && app.Constraints != nil {
+		for _, c := range *app.Constraints {
+			if !p.allowsConstraint(c) {
+				v = append(v, fmt.Sprintf("constraint %q is not in the approved set", c))
+			}
+		}
+	}
+
+	return v
+}
+
+// evaluateInstances checks an instance count, e.g. the target of a scale
+func (p *Policy) evaluateInstances(instances int) PolicyViolations {
+	if p.MaxInstances > 0 && instances > p.MaxInstances {
+		return PolicyViolations{fmt.Sprintf("instances %d exceeds the maximum of %d", instances, p.MaxInstances)}
+	}
+	return nil
+}
+
+func (p *Policy) allowsConstraint(constraint []string) bool {
+	for _, allowed := range p.AllowedConstraints {
+		if len(allowed) > len(constraint) {
+			continue
+		}
+
+		matched := true
+
+		for i := range allowed {
+			if allowed[i] != constraint[i] {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isLatestTag reports whether image refers to the latest tag, explicitly or
+// by omitting the tag
+func isLatestTag(image string) bool {
+	if strings.Contains(image, "@") {
+		return false
+	}
+
+	name := image[strings.LastIndex(image, "/")+1:]
+	i := strings.LastIndex(name, ":")
+
+	return i < 0 || name[i+1:] == "latest"
+}
@@ -0,0 +1,181 @@
+package deploy
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	marathon "github.com/fbcbarbosa/go-marathon"
+)
+
+var policy = `
+maxCpus: 1
+maxMem: 1024
+maxInstances: 10
+forbidLatestTag: true
+requireHealthChecks: true
+requiredLabels: [team, cost-center]
+forbidPrivileged: true
+forbidHostNetwork: true
+allowedConstraints:
+  - [hostname, UNIQUE]
+  - [zone, GROUP_BY]
+`
+
+var appViolatingPolicy = `
+id: quintoandar/app
+cpus: 2
+mem: 128
+instances: 20
+labels:
+  team: platform
+constraints:
+  - [hostname, UNIQUE]
+  - [zone, GROUP_BY, "2"]
+  - [rack, CLUSTER, "a"]
+container:
+  type: DOCKER
+  docker:
+    image: registry:5000/quintoandar/app
+    network: HOST
+    privileged: true
+`
+
+func TestPolicyEvaluate(t *testing.T) {
+	p := loadTestPolicy(t)
+
+	var application marathon.Application
+
+	b, err := parseData(appViolatingPolicy)
+
+	if err != nil {
+		t.Fatalf("parseData failed: \n%v", err)
+	}
+
+	if err := application.UnmarshalJSON(b); err != nil {
+		t.Fatalf("UnmarshalJSON failed: \n%v", err)
+	}
+
+	expected := []string{
+		"cpus 2 exceeds the maximum of 1",
+		"instances 20 exceeds the maximum of 10",
+		"healthChecks are required",
+		`label "cost-center" is required`,
+		`image "registry:5000/quintoandar/app" must be pinned to a tag other than latest`,
+		"privileged docker containers are forbidden",
+		"HOST networking is forbidden",
+		`constraint ["rack" "CLUSTER" "a"] is not in the approved set`,
+	}
+
+	violations := p.Evaluate(&application)
+
+	if len(violations) != len(expected) {
+		t.Fatalf("unexpected violations: \n%v", violations)
+	}
+
+	for i := range expected {
+		if violations[i] != expected[i] {
+			t.Fatalf("unexpected violation %d: \n%s", i, violations[i])
+		}
+	}
+}
+
+func TestPolicyEvaluateCompliant(t *testing.T) {
+	p := loadTestPolicy(t)
+
+	var application marathon.Application
+
+	b, err := parseData(app)
+
+	if err != nil {
+		t.Fatalf("parseData failed: \n%v", err)
+	}
+
+	if err := application.UnmarshalJSON(b); err != nil {
+		t.Fatalf("UnmarshalJSON failed: \n%v", err)
+	}
+
+	application.Container.Docker.Image = "quintoandar/app:1.0.0"
+	application.AddLabel("team", "platform")
+	application.AddLabel("cost-center", "42")
+
+	if violations := p.Evaluate(&application); len(violations) > 0 {
+		t.Fatalf("unexpected violations: \n%v", violations)
+	}
+}
+
+func TestIsLatestTag(t *testing.T) {
+	tests := map[string]bool{
+		"quintoandar/app":               true,
+		"quintoandar/app:latest":        true,
+		"registry:5000/quintoandar/app": true,
+		"registry:5000/app:1.0":         false,
+		"quintoandar/app@sha256:abcd":   false,
+	}
+
+	for image, expected := range tests {
+		if isLatestTag(image) != expected {
+			t.Fatalf("isLatestTag(%q) != %v", image, expected)
+		}
+	}
+}
+
+func TestPolicyHostNetworks(t *testing.T) {
+	p := loadTestPolicy(t)
+
+	application := parseApp(t, `
+id: quintoandar/app
+container:
+  type: DOCKER
+  docker:
+    image: quintoandar/app:1.0.0
+networks:
+  - mode: host
+`)
+
+	violations := p.Evaluate(application)
+
+	for _, v := range violations {
+		if v == "HOST networking is forbidden" {
+			return
+		}
+	}
+
+	t.Fatalf("host networks were not reported: \n%v", violations)
+}
+
+func TestLoadPolicyUnknownRule(t *testing.T) {
+	if _, err := loadPolicyData(t, "maxCpu: 1\n"); err == nil || !strings.Contains(err.Error(), "maxCpu") {
+		t.Fatalf("LoadPolicy did not refuse the unknown rule: %v", err)
+	}
+}
+
+func loadTestPolicy(t *testing.T) *Policy {
+	p, err := loadPolicyData(t, policy)
+
+	if err != nil {
+		t.Fatalf("LoadPolicy failed: \n%v", err)
+	}
+
+	return p
+}
+
+// loadPolicyData loads the policy data through a file
+func loadPolicyData(t *testing.T, data string) (*Policy, error) {
+	f, err := ioutil.TempFile("", "policy")
+
+	if err != nil {
+		t.Fatalf("failed to create policy file: \n%v", err)
+	}
+
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatalf("failed to write policy file: \n%v", err)
+	}
+
+	f.Close()
+
+	return LoadPolicy(f.Name())
+}
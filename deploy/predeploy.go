@@ -0,0 +1,195 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	marathon "github.com/fbcbarbosa/go-marathon"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// preDeploySuffix is appended to the application id to name the temporary
+// application running the pre-deploy task
+const preDeploySuffix = "-pre-deploy"
+
+// preDeployBackoff delays relaunching the pre-deploy task once it exits, as
+// Marathon keeps applications running
+var preDeployBackoff = float64(time.Hour / time.Second)
+
+// preDeployApp returns a temporary application running cmd once with the
+// image and resources of app. It has no health checks, nor labels that would
+// expose it to load balancers, nor ports or volumes the tasks of app hold
+// while they run. The constraints are kept, a single task satisfies them.
+func preDeployApp(app *marathon.Application, cmd string) *marathon.Application {
+	task := *app
+	instances := 1
+	requirePorts := false
+
+	task.ID = app.ID + preDeploySuffix
+	task.Cmd = &cmd
+	task.Args = nil
+	task.Instances = &instances
+	task.HealthChecks = &[]marathon.HealthCheck{}
+	task.ReadinessChecks = &[]marathon.ReadinessCheck{}
+	task.PortDefinitions = &[]marathon.PortDefinition{}
+	task.RequirePorts = &requirePorts
+	task.Residency = nil
+	task.Labels = nil
+	task.Dependencies = nil
+	task.UpgradeStrategy = nil
+	task.BackoffSeconds = &preDeployBackoff
+	task.MaxLaunchDelaySeconds = &preDeployBackoff
+
+	if app.Container != nil {
+		container := *app.Container
+		task.Container = &container
+
+		if app.Container.Docker != nil {
+			docker := *app.Container.Docker
+			docker.PortMappings = &[]marathon.PortMapping{}
+			container.Docker = &docker
+		}
+
+		if app.Container.Volumes != nil {
+			container.Volumes = sharedVolumes(*app.Container.Volumes)
+		}
+	}
+
+	return &task
+}
+
+// sharedVolumes returns the volumes but the persistent and external ones,
+// which are bound to the tasks of the application
+func sharedVolumes(volumes []marathon.Volume) *[]marathon.Volume {
+	shared := []marathon.Volume{}
+
+	for _, v := range volumes {
+		if v.Persistent == nil && v.External == nil {
+			shared = append(shared, v)
+		}
+	}
+
+	return &shared
+}
+
+// preDeploy runs the pre-deploy task and removes its temporary application,
+// the deploy only goes on when the task finished successfully
+func (d *Deployer) preDeploy(c context.Context, ctx *log.Entry, app *marathon.Application, timeout time.Duration) error {
+	task := preDeployApp(app, d.opts.PreDeploy)
+
+	ctx = ctx.WithFields(log.Fields{
+		"phase":    phasePreDeploy,
+		"task_app": task.ID,
+	})
+
+	ctx.WithField("cmd", d.opts.PreDeploy).Info("running pre-deploy task")
+
+	dep, err := d.client.UpdateApplication(task, true)
+
+	if err != nil {
+		ctx.WithError(err).Error("failed to start pre-deploy task")
+		return err
+	}
+
+	defer d.removePreDeploy(ctx, task.ID)
+
+	start := time.Now()
+	err = waitOnTask(c, d.client, task.ID, dep.Version, timeout)
+
+	if err != nil {
+		ctx.WithFields(log.Fields{
+			"err":         err,
+			"duration_ms": durationMS(start),
+			"timeout":     timeout,
+		}).Error("pre-deploy task failed")
+		return err
+	}
+
+	ctx.WithField("duration_ms", durationMS(start)).Info("pre-deploy task finished successfully")
+	return nil
+}
+
+// removePreDeploy deletes the temporary application, even when the deploy
+// was interrupted
+func (d *Deployer) removePreDeploy(ctx *log.Entry, id string) {
+	c, cancel := context.WithTimeout(context.Background(), d.opts.drainTimeout())
+	defer cancel()
+
+	dep, err := d.client.DeleteApplication(id, true)
+
+	if err == nil {
+		err = waitOnDeployment(c, d.client, dep.DeploymentID, d.opts.drainTimeout(), nil, 0, nil)
+	}
+
+	if err != nil {
+		ctx.WithError(err).Error("failed to remove the pre-deploy task application, remove it by hand")
+		return
+	}
+
+	ctx.Info("pre-deploy task application removed")
+}
+
+// waitOnTask waits for the task of the version of the application to exit,
+// failing unless it finished successfully. Marathon does not list finished
+// tasks, a task gone without a failure being recorded has finished.
+func waitOnTask(c context.Context, client Client, name, version string, timeout time.Duration) error {
+	seen := map[string]bool{}
+
+	tick := time.NewTicker(deploymentPollInterval)
+	defer tick.Stop()
+	tout := time.After(timeout)
+
+	for {
+		if err := taskFailure(client, name, version); err != nil {
+			return err
+		}
+
+		tasks, err := client.Tasks(name)
+
+		if err != nil {
+			return err
+		}
+
+		live := map[string]bool{}
+
+		for _, t := range tasks.Tasks {
+			if t.Version == version {
+				live[t.ID] = true
+				seen[t.ID] = true
+			}
+		}
+
+		for id := range seen {
+			if !live[id] {
+				// the task may have failed since the failure was checked
+				return taskFailure(client, name, version)
+			}
+		}
+
+		select {
+		case <-tick.C:
+		case <-tout:
+			return errors.New("timed out waiting on the task to finish")
+		case <-c.Done():
+			return c.Err()
+		}
+	}
+}
+
+// taskFailure returns the last task failure of the version of the application
+func taskFailure(client Client, name, version string) error {
+	app, err := client.Application(name)
+
+	if err != nil {
+		return err
+	}
+
+	if f := app.LastTaskFailure; f != nil && f.Version == version {
+		return fmt.Errorf("task %s exited with %s: %s", f.TaskID, f.State, f.Message)
+	}
+
+	return nil
+}
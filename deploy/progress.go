@@ -0,0 +1,111 @@
+package deploy
+
+import (
+	"fmt"
+	"strings"
+
+	marathon "github.com/fbcbarbosa/go-marathon"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// progress logs the state of a running deployment: its current step and
+// actions, the instances of the new version and the old tasks remaining
+type progress struct {
+	client     Client
+	ctx        *log.Entry
+	app        string
+	deployment string
+	version    string
+	// target is the number of instances, unknown (zero) for rollbacks
+	target int
+}
+
+func newProgress(client Client, ctx *log.Entry, app *marathon.Application, dep *marathon.DeploymentID) *progress {
+	target := 1
+
+	if app.Instances != nil {
+		target = *app.Instances
+	}
+
+	return &progress{
+		client:     client,
+		ctx:        ctx,
+		app:        app.ID,
+		deployment: dep.DeploymentID,
+		version:    dep.Version,
+		target:     target,
+	}
+}
+
+func (p *progress) report() {
+	fields := log.Fields{
+		"deployment": p.deployment,
+		"version":    p.version,
+	}
+
+	if p.target > 0 {
+		fields["target"] = p.target
+	}
+
+	if deployments, err := p.client.Deployments(); err == nil {
+		for _, d := range deployments {
+			if d.ID != p.deployment {
+				continue
+			}
+
+			var actions []string
+
+			for _, a := range d.CurrentActions {
+				actions = append(actions, a.Action+" "+a.App)
+			}
+
+			fields["step"] = fmt.Sprintf("%d/%d", d.CurrentStep, d.TotalSteps)
+			fields["actions"] = strings.Join(actions, ", ")
+		}
+	}
+
+	if tasks, err := p.client.Tasks(p.app); err == nil {
+		staged, running, healthy, old := 0, 0, 0, 0
+
+		for _, t := range tasks.Tasks {
+			if t.Version != p.version {
+				old++
+				continue
+			}
+
+			if t.State != "TASK_RUNNING" {
+				staged++
+				continue
+			}
+
+			running++
+
+			if isHealthy(t) {
+				healthy++
+			}
+		}
+
+		fields["staged"] = staged
+		fields["running"] = running
+		fields["healthy"] = healthy
+		fields["old_tasks"] = old
+	}
+
+	p.ctx.WithFields(fields).Info("deployment in progress")
+}
+
+// isHealthy reports whether all health checks of the task pass
+func isHealthy(t marathon.Task) bool {
+	if len(t.HealthCheckResults) == 0 {
+		return false
+	}
+
+	for _, h := range t.HealthCheckResults {
+		if h == nil || !h.Alive {
+			return false
+		}
+	}
+
+	return true
+}
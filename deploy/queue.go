@@ -0,0 +1,31 @@
+package deploy
+
+import (
+	log "github.com/Sirupsen/logrus"
+)
+
+// resetDelay removes the launch delay Marathon applies to the application
+// after its tasks failed, which would hold back the next deployment for up
+// to the maximum launch delay. Failing to reset it only logs a warning.
+func (d *Deployer) resetDelay(ctx *log.Entry, appID string) {
+	queue, err := d.client.Queue()
+
+	if err != nil {
+		ctx.WithError(err).Warning("failed to get the launch queue")
+		return
+	}
+
+	for _, item := range queue.Items {
+		if normalizeID(item.Application.ID) != normalizeID(appID) || item.Delay.TimeLeftSeconds <= 0 {
+			continue
+		}
+
+		if err := d.client.DeleteQueueDelay(appID); err != nil {
+			ctx.WithError(err).Warning("failed to reset the launch delay")
+			return
+		}
+
+		ctx.WithField("delay_seconds", item.Delay.TimeLeftSeconds).Info("reset the launch delay")
+		return
+	}
+}
@@ -0,0 +1,118 @@
+package deploy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Deploy outcomes
+const (
+	OutcomeSuccess        = "success"
+	OutcomeFailed         = "failed"
+	OutcomeRolledBack     = "rolled-back"
+	OutcomeRollbackFailed = "rollback-failed"
+)
+
+// Result is the machine-readable summary of a deploy, the plugin writes it as
+// a report for downstream pipeline steps
+type Result struct {
+	App             string       `json:"app,omitempty"`
+	Deployment      string       `json:"deployment,omitempty"`
+	Rollback        string       `json:"rollback,omitempty"`
+	Version         string       `json:"version,omitempty"`
+	PreviousVersion string       `json:"previousVersion,omitempty"`
+	StartedAt       time.Time    `json:"startedAt"`
+	FinishedAt      time.Time    `json:"finishedAt"`
+	DurationSeconds float64      `json:"durationSeconds"`
+	Outcome         string       `json:"outcome"`
+	Error           string       `json:"error,omitempty"`
+	Tasks           *TaskSummary `json:"tasks,omitempty"`
+}
+
+// TaskSummary holds the application task counts and health once the deploy
+// has finished
+type TaskSummary struct {
+	Instances int `json:"instances"`
+	Running   int `json:"running"`
+	Staged    int `json:"staged"`
+	Healthy   int `json:"healthy"`
+	Unhealthy int `json:"unhealthy"`
+}
+
+// NewResult creates a Result for a deploy starting now
+func NewResult() *Result {
+	return &Result{StartedAt: time.Now().UTC()}
+}
+
+// Finish records the end of the deploy and its outcome, err is the error
+// returned by the deploy (if any)
+func (r *Result) Finish(err error) {
+	r.FinishedAt = time.Now().UTC()
+	r.DurationSeconds = r.FinishedAt.Sub(r.StartedAt).Seconds()
+
+	if err == nil {
+		r.Outcome = OutcomeSuccess
+		return
+	}
+
+	if r.Outcome == "" {
+		r.Outcome = OutcomeFailed
+	}
+
+	r.Error = err.Error()
+}
+
+// Event returns the lifecycle event matching the deploy outcome
+func (r *Result) Event() string {
+	switch r.Outcome {
+	case OutcomeSuccess:
+		return EventDeploySucceeded
+	case OutcomeRolledBack:
+		return EventRollbackSucceeded
+	case OutcomeRollbackFailed:
+		return EventRollbackFailed
+	}
+	return EventDeployFailed
+}
+
+// collect fetches the final task counts of the application
+func (r *Result) collect(client Client) {
+	app, err := client.Application(r.App)
+
+	if err != nil {
+		log.WithField("app", r.App).WithError(err).
+			Warning("could not get application status for the deploy result")
+		return
+	}
+
+	r.Tasks = &TaskSummary{
+		Running:   app.TasksRunning,
+		Staged:    app.TasksStaged,
+		Healthy:   app.TasksHealthy,
+		Unhealthy: app.TasksUnhealthy,
+	}
+
+	if app.Instances != nil {
+		r.Tasks.Instances = *app.Instances
+	}
+}
+
+// WriteFile saves the result as JSON, creating parent directories as needed
+func (r *Result) WriteFile(file string) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(file, b, 0644)
+}
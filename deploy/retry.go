@@ -0,0 +1,327 @@
+package deploy
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	marathon "github.com/fbcbarbosa/go-marathon"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// backoff bounds between retries
+var (
+	retryInitialBackoff = 500 * time.Millisecond
+	retryMaxBackoff     = 10 * time.Second
+)
+
+// retryClockSkew is how much earlier than the first attempt, by the local
+// clock, a deployment may have been created by Marathon and still be the one
+// the attempt started
+const retryClockSkew = 5 * time.Second
+
+// retryClient retries the Marathon calls made during a deploy when they fail
+// with transient errors, using exponential backoff with jitter for at most
+// timeout. Calls it does not override are not retried.
+type retryClient struct {
+	Client
+	ctx     context.Context
+	timeout time.Duration
+}
+
+// WithRetry wraps client so transient failures are retried for at most
+// timeout, a zero timeout disables retries. Cancelling c stops waiting for
+// the next attempt and returns the last failure.
+func WithRetry(c context.Context, client Client, timeout time.Duration) Client {
+	if timeout <= 0 {
+		return client
+	}
+	return &retryClient{Client: client, ctx: c, timeout: timeout}
+}
+
+// isRetryable reports whether err is a transient failure. go-marathon
+// reports 5xx responses and connection failures as ErrMarathonDown once every
+// member has been marked down.
+func isRetryable(err error) bool {
+	if err == marathon.ErrMarathonDown || err == io.ErrUnexpectedEOF {
+		return true
+	}
+
+	if apiErr, ok := err.(*marathon.APIError); ok {
+		return apiErr.ErrCode == marathon.ErrCodeServer ||
+			apiErr.ErrCode == marathon.ErrCodeAppLocked
+	}
+
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+
+	return strings.Contains(err.Error(), "connection reset")
+}
+
+// do calls fn until it succeeds, fails with a permanent error or the retry
+// timeout is exhausted
+func (r *retryClient) do(call string, fn func() error) error {
+	deadline := time.Now().Add(r.timeout)
+	backoff := retryInitialBackoff
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+
+		if err == nil || !isRetryable(err) {
+			return err
+		}
+
+		// equal jitter: wait between half and the whole backoff
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+
+		if time.Now().Add(wait).After(deadline) {
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"attempt": attempt,
+			"backoff": wait,
+			"call":    call,
+			"err":     err,
+		}).Warning("transient Marathon API failure, retrying")
+
+		select {
+		case <-time.After(wait):
+		case <-r.ctx.Done():
+			return err
+		}
+
+		if backoff *= 2; backoff > retryMaxBackoff {
+			backoff = retryMaxBackoff
+		}
+	}
+}
+
+func (r *retryClient) Application(name string) (app *marathon.Application, err error) {
+	err = r.do("Application", func() error {
+		app, err = r.Client.Application(name)
+		return err
+	})
+	return
+}
+
+func (r *retryClient) Tasks(name string) (tasks *marathon.Tasks, err error) {
+	err = r.do("Tasks", func() error {
+		tasks, err = r.Client.Tasks(name)
+		return err
+	})
+	return
+}
+
+func (r *retryClient) Applications(v url.Values) (apps *marathon.Applications, err error) {
+	err = r.do("Applications", func() error {
+		apps, err = r.Client.Applications(v)
+		return err
+	})
+	return
+}
+
+func (r *retryClient) Group(name string) (group *marathon.Group, err error) {
+	err = r.do("Group", func() error {
+		group, err = r.Client.Group(name)
+		return err
+	})
+	return
+}
+
+func (r *retryClient) Deployments() (deployments []*marathon.Deployment, err error) {
+	err = r.do("Deployments", func() error {
+		deployments, err = r.Client.Deployments()
+		return err
+	})
+	return
+}
+
+func (r *retryClient) HasDeployment(id string) (found bool, err error) {
+	err = r.do("HasDeployment", func() error {
+		found, err = r.Client.HasDeployment(id)
+		return err
+	})
+	return
+}
+
+func (r *retryClient) WaitOnDeployment(id string, timeout time.Duration) error {
+	return r.do("WaitOnDeployment", func() error {
+		return r.Client.WaitOnDeployment(id, timeout)
+	})
+}
+
+func (r *retryClient) DeleteDeployment(id string, force bool) (dep *marathon.DeploymentID, err error) {
+	err = r.do("DeleteDeployment", func() error {
+		dep, err = r.Client.DeleteDeployment(id, force)
+		return err
+	})
+	return
+}
+
+func (r *retryClient) Queue() (queue *marathon.Queue, err error) {
+	err = r.do("Queue", func() error {
+		queue, err = r.Client.Queue()
+		return err
+	})
+	return
+}
+
+func (r *retryClient) DeleteQueueDelay(appID string) error {
+	return r.do("DeleteQueueDelay", func() error {
+		return r.Client.DeleteQueueDelay(appID)
+	})
+}
+
+func (r *retryClient) SupportsPods() (found bool, err error) {
+	err = r.do("SupportsPods", func() error {
+		found, err = r.Client.SupportsPods()
+		return err
+	})
+	return
+}
+
+func (r *retryClient) Pods() (pods []marathon.Pod, err error) {
+	err = r.do("Pods", func() error {
+		pods, err = r.Client.Pods()
+		return err
+	})
+	return
+}
+
+// UpdateApplication is not idempotent, before retrying it checks whether the
+// failed attempt did reach Marathon and started a deployment of the app
+func (r *retryClient) UpdateApplication(app *marathon.Application, force bool) (dep *marathon.DeploymentID, err error) {
+	var sent time.Time
+
+	err = r.do("UpdateApplication", func() error {
+		if !sent.IsZero() {
+			dep, err = r.findDeployment(app.ID, sent, func(current *marathon.Application) bool {
+				return sameDefinition(app, current)
+			})
+
+			if err != nil || dep != nil {
+				return err
+			}
+		} else {
+			sent = time.Now()
+		}
+
+		dep, err = r.Client.UpdateApplication(app, force)
+		return err
+	})
+	return
+}
+
+// SetApplicationVersion is retried like UpdateApplication
+func (r *retryClient) SetApplicationVersion(name string, version *marathon.ApplicationVersion) (dep *marathon.DeploymentID, err error) {
+	var sent time.Time
+
+	err = r.do("SetApplicationVersion", func() error {
+		if !sent.IsZero() {
+			if dep, err = r.findDeployment(name, sent, nil); err != nil || dep != nil {
+				return err
+			}
+		} else {
+			sent = time.Now()
+		}
+
+		dep, err = r.Client.SetApplicationVersion(name, version)
+		return err
+	})
+	return
+}
+
+// findDeployment returns the deployment a previous attempt, first sent at
+// sent, started: one affecting the app, created since then and deploying the
+// current version of the app, which matches when set must accept. There is
+// none when the attempts did not reach Marathon.
+func (r *retryClient) findDeployment(appID string, sent time.Time,
+	matches func(*marathon.Application) bool) (*marathon.DeploymentID, error) {
+
+	deployments, err := r.Client.Deployments()
+
+	if err != nil {
+		return nil, err
+	}
+
+	id := "/" + strings.TrimPrefix(appID, "/")
+
+	for _, d := range deployments {
+		created, err := time.Parse(time.RFC3339Nano, d.Version)
+
+		if err != nil || created.Before(sent.Add(-retryClockSkew)) || !affects(d, id) {
+			continue
+		}
+
+		app, err := r.Client.Application(appID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if app.Version != d.Version || (matches != nil && !matches(app)) {
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"app":        appID,
+			"deployment": d.ID,
+		}).Info("previous attempt started a deployment, not retrying")
+		return &marathon.DeploymentID{DeploymentID: d.ID, Version: d.Version}, nil
+	}
+
+	return nil, nil
+}
+
+func affects(d *marathon.Deployment, id string) bool {
+	for _, affected := range d.AffectedApps {
+		if affected == id {
+			return true
+		}
+	}
+	return false
+}
+
+// sameDefinition reports whether the current application runs what was sent:
+// the same command, image, environment and labels
+func sameDefinition(sent, current *marathon.Application) bool {
+	if sent.Cmd != nil && (current.Cmd == nil || *current.Cmd != *sent.Cmd) {
+		return false
+	}
+
+	if appImage(sent) != appImage(current) {
+		return false
+	}
+
+	if sent.Env != nil {
+		for k, v := range *sent.Env {
+			if current.Env == nil || (*current.Env)[k] != v {
+				return false
+			}
+		}
+	}
+
+	if sent.Labels != nil {
+		for k, v := range *sent.Labels {
+			if current.Labels == nil || (*current.Labels)[k] != v {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func appImage(app *marathon.Application) string {
+	if app.Container == nil || app.Container.Docker == nil {
+		return ""
+	}
+	return app.Container.Docker.Image
+}
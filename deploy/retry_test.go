@@ -0,0 +1,173 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	marathon "github.com/fbcbarbosa/go-marathon"
+)
+
+// flakyClient fails the first calls with err
+type flakyClient struct {
+	Client
+	err         error
+	failures    int
+	calls       int
+	updates     int
+	app         *marathon.Application
+	deployments []*marathon.Deployment
+}
+
+func (f *flakyClient) fail() error {
+	f.calls++
+	if f.calls <= f.failures {
+		return f.err
+	}
+	return nil
+}
+
+func (f *flakyClient) Application(name string) (*marathon.Application, error) {
+	if err := f.fail(); err != nil {
+		return nil, err
+	}
+	if f.app != nil {
+		return f.app, nil
+	}
+	return &marathon.Application{ID: name}, nil
+}
+
+func (f *flakyClient) UpdateApplication(app *marathon.Application, force bool) (*marathon.DeploymentID, error) {
+	f.updates++
+	version := time.Now().UTC().Format(time.RFC3339Nano)
+
+	// the request reaches Marathon but the response is lost
+	f.app = &marathon.Application{ID: app.ID, Version: version, Container: app.Container}
+	f.deployments = append(f.deployments, &marathon.Deployment{
+		ID:           fmt.Sprintf("deployment-%d", f.updates),
+		Version:      version,
+		AffectedApps: []string{"/quintoandar/app"},
+	})
+	return nil, f.err
+}
+
+func (f *flakyClient) Deployments() ([]*marathon.Deployment, error) {
+	return f.deployments, nil
+}
+
+func init() {
+	retryInitialBackoff = time.Millisecond
+	retryMaxBackoff = 5 * time.Millisecond
+}
+
+func TestRetryTransientFailure(t *testing.T) {
+	flaky := &flakyClient{err: marathon.ErrMarathonDown, failures: 3}
+	client := WithRetry(context.Background(), flaky, time.Minute)
+
+	app, err := client.Application("quintoandar/app")
+
+	if err != nil || app.ID != "quintoandar/app" {
+		t.Fatalf("Application was not retried: \n%v", err)
+	}
+
+	if flaky.calls != 4 {
+		t.Fatalf("unexpected number of calls: %d", flaky.calls)
+	}
+}
+
+func TestRetryPermanentFailure(t *testing.T) {
+	flaky := &flakyClient{err: marathon.NewAPIError(400, []byte("{}")), failures: 3}
+	client := WithRetry(context.Background(), flaky, time.Minute)
+
+	if _, err := client.Application("quintoandar/app"); err == nil {
+		t.Fatalf("Application did not fail")
+	}
+
+	if flaky.calls != 1 {
+		t.Fatalf("permanent failure was retried %d times", flaky.calls-1)
+	}
+}
+
+func TestRetryTimeout(t *testing.T) {
+	flaky := &flakyClient{err: marathon.ErrMarathonDown, failures: 1000}
+	client := WithRetry(context.Background(), flaky, 50*time.Millisecond)
+
+	if _, err := client.Application("quintoandar/app"); err != marathon.ErrMarathonDown {
+		t.Fatalf("Application did not give up: \n%v", err)
+	}
+}
+
+func TestRetryUpdateApplicationChecksDeployments(t *testing.T) {
+	flaky := &flakyClient{err: marathon.ErrMarathonDown}
+	client := WithRetry(context.Background(), flaky, time.Minute)
+
+	dep, err := client.UpdateApplication(&marathon.Application{ID: "quintoandar/app"}, true)
+
+	if err != nil {
+		t.Fatalf("UpdateApplication failed: \n%v", err)
+	}
+
+	if dep.DeploymentID != "deployment-1" {
+		t.Fatalf("unexpected deployment: %s", dep.DeploymentID)
+	}
+
+	if flaky.updates != 1 {
+		t.Fatalf("application was updated %d times", flaky.updates)
+	}
+}
+
+func TestRetryUpdateApplicationIgnoresOtherDeployments(t *testing.T) {
+	other := marathon.NewDockerApplication()
+	other.Container.Docker.Container("quintoandar/app:1")
+
+	flaky := &flakyClient{
+		err: marathon.ErrMarathonDown,
+		app: other,
+		deployments: []*marathon.Deployment{{
+			ID:           "older",
+			Version:      time.Now().Add(-time.Hour).UTC().Format(time.RFC3339Nano),
+			AffectedApps: []string{"/quintoandar/app"},
+		}},
+	}
+	client := WithRetry(context.Background(), flaky, 50*time.Millisecond)
+
+	app := marathon.NewDockerApplication()
+	app.ID = "quintoandar/app"
+	app.Container.Docker.Container("quintoandar/app:2")
+
+	// the older deployment is not the attempt's, so the update is sent again
+	// and its deployment then found
+	dep, err := client.UpdateApplication(app, true)
+
+	if err != nil || dep.DeploymentID != "deployment-1" {
+		t.Fatalf("unexpected deployment: %+v, %v", dep, err)
+	}
+
+	// a deployment of another definition started since the attempt is not
+	// the attempt's either
+	flaky.app = other
+	flaky.app.Version = flaky.deployments[1].Version
+
+	if found, err := client.(*retryClient).findDeployment(app.ID, time.Now(), func(current *marathon.Application) bool {
+		return sameDefinition(app, current)
+	}); err != nil || found != nil {
+		t.Fatalf("deployment of another definition was matched: %+v, %v", found, err)
+	}
+}
+
+func TestRetryInterrupted(t *testing.T) {
+	flaky := &flakyClient{err: marathon.ErrMarathonDown, failures: 1000}
+	c, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+
+	if _, err := WithRetry(c, flaky, time.Minute).Application("quintoandar/app"); err != marathon.ErrMarathonDown {
+		t.Fatalf("Application did not fail: \n%v", err)
+	}
+
+	if flaky.calls != 1 || time.Since(start) > time.Second {
+		t.Fatalf("Application was retried after the interruption: %d calls", flaky.calls)
+	}
+}
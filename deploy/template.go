@@ -0,0 +1,89 @@
+package deploy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// templateFuncs is the function set available to marathonfile templates,
+// it deliberately exposes nothing that reaches outside the process
+var templateFuncs = template.FuncMap{
+	"default":  defaultValue,
+	"required": required,
+	"toJSON":   toJSON,
+	"b64":      b64,
+	"env":      os.Getenv,
+	"split":    split,
+}
+
+// renderTemplate renders a marathonfile with text/template. Environment
+// variables are available as fields ({{ .DRONE_BRANCH }}) and referencing an
+// undefined one is an error, use env to read optional variables instead
+func renderTemplate(name, text string) (string, error) {
+	t, err := template.New(name).
+		Option("missingkey=error").
+		Funcs(templateFuncs).
+		Parse(text)
+
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+
+	if err := t.Execute(&out, environ()); err != nil {
+		return "", err
+	}
+
+	return out.String(), nil
+}
+
+func environ() map[string]string {
+	env := map[string]string{}
+
+	for _, kv := range os.Environ() {
+		if i := strings.Index(kv, "="); i > 0 {
+			env[kv[:i]] = kv[i+1:]
+		}
+	}
+
+	return env
+}
+
+// defaultValue returns value unless it is empty, {{ env "TAG" | default "latest" }}
+func defaultValue(def, value interface{}) interface{} {
+	if value == nil || value == "" {
+		return def
+	}
+	return value
+}
+
+// required fails the rendering when value is empty, {{ required "TAG is required" .TAG }}
+func required(msg string, value interface{}) (interface{}, error) {
+	if value == nil || value == "" {
+		return nil, errors.New(msg)
+	}
+	return value, nil
+}
+
+func toJSON(value interface{}) (string, error) {
+	b, err := json.Marshal(value)
+	return string(b), err
+}
+
+func b64(value string) string {
+	return base64.StdEncoding.EncodeToString([]byte(value))
+}
+
+// split has its separator first so it can be used in pipelines, {{ .PORTS | split "," }}
+func split(sep, value string) []string {
+	if value == "" {
+		return []string{}
+	}
+	return strings.Split(value, sep)
+}
@@ -0,0 +1,79 @@
+package deploy
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+var appTemplate = `
+id: quintoandar/app
+instances: {{ env "INSTANCES" | default 2 }}
+container:
+  docker:
+    image: quintoandar/app:{{ .TEMPLATE_TAG }}
+    portMappings:
+    {{- range .TEMPLATE_PORTS | split "," }}
+      - containerPort: {{ . }}
+    {{- end }}
+{{- if eq .TEMPLATE_ENV "production" }}
+constraints:
+  - ["hostname", "UNIQUE"]
+{{- end }}
+labels:
+  SECRET: {{ b64 "secret" }}
+  PORTS: {{ toJSON (split "," .TEMPLATE_PORTS) | printf "%q" }}
+`
+
+func TestRenderTemplate(t *testing.T) {
+	os.Setenv("TEMPLATE_TAG", "v1")
+	os.Setenv("TEMPLATE_PORTS", "8080,9090")
+	os.Setenv("TEMPLATE_ENV", "production")
+	defer os.Unsetenv("TEMPLATE_TAG")
+	defer os.Unsetenv("TEMPLATE_PORTS")
+	defer os.Unsetenv("TEMPLATE_ENV")
+
+	out, err := renderTemplate("marathon.yaml", appTemplate)
+
+	if err != nil {
+		t.Fatalf("renderTemplate failed: \n%v", err)
+	}
+
+	expected := `
+id: quintoandar/app
+instances: 2
+container:
+  docker:
+    image: quintoandar/app:v1
+    portMappings:
+      - containerPort: 8080
+      - containerPort: 9090
+constraints:
+  - ["hostname", "UNIQUE"]
+labels:
+  SECRET: c2VjcmV0
+  PORTS: "[\"8080\",\"9090\"]"
+`
+
+	assertSameDocument(t, expected, out)
+}
+
+func TestRenderTemplateUndefinedVariable(t *testing.T) {
+	_, err := renderTemplate("marathon.yaml", "id: app\nimage: {{ .TEMPLATE_UNDEFINED }}\n")
+
+	if err == nil {
+		t.Fatalf("renderTemplate did not fail")
+	}
+
+	if !strings.Contains(err.Error(), "marathon.yaml:2") {
+		t.Fatalf("error does not point to the template line: \n%v", err)
+	}
+}
+
+func TestRenderTemplateRequired(t *testing.T) {
+	_, err := renderTemplate("marathon.yaml", `id: {{ env "TEMPLATE_UNDEFINED" | required "app id is required" }}`)
+
+	if err == nil || !strings.Contains(err.Error(), "app id is required") {
+		t.Fatalf("renderTemplate did not fail with required message: \n%v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package deploy
+
+import (
+	"errors"
+	"time"
+)
+
+// errNoDeployBudget is returned when the overall deadline leaves no time to
+// deploy once the drain and rollback timeouts are reserved
+var errNoDeployBudget = errors.New(
+	"the deadline leaves no time to deploy after reserving the drain and rollback timeouts",
+)
+
+// errNoRollbackBudget is returned instead of starting a rollback the overall
+// deadline leaves no time to finish
+var errNoRollbackBudget = errors.New(
+	"the deadline left no time to roll back, the application is left at the failed version",
+)
+
+// budget spreads the optional overall deadline across the deploy phases
+type budget struct {
+	deadline time.Time
+}
+
+func newBudget(deadline time.Duration) budget {
+	if deadline <= 0 {
+		return budget{}
+	}
+	return budget{deadline: time.Now().Add(deadline)}
+}
+
+// timeout returns the phase timeout shortened to what is left of the deadline
+// after reserving time for the phases that may follow, 0 when nothing is left
+func (b budget) timeout(timeout, reserve time.Duration) time.Duration {
+	if b.deadline.IsZero() {
+		return timeout
+	}
+
+	left := time.Until(b.deadline) - reserve
+
+	if left <= 0 {
+		return 0
+	}
+
+	if left < timeout {
+		return left
+	}
+
+	return timeout
+}
+
+func (o Options) drainTimeout() time.Duration {
+	if o.DrainTimeout > 0 {
+		return o.DrainTimeout
+	}
+	return o.Timeout
+}
+
+func (o Options) rollbackTimeout() time.Duration {
+	if o.RollbackTimeout > 0 {
+		return o.RollbackTimeout
+	}
+	return o.Timeout
+}
+
+func (o Options) preDeployTimeout() time.Duration {
+	if o.PreDeployTimeout > 0 {
+		return o.PreDeployTimeout
+	}
+	return o.Timeout
+}
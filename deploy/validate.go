@@ -0,0 +1,272 @@
+package deploy
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	marathon "github.com/fbcbarbosa/go-marathon"
+)
+
+// ValidationErrors is the error returned when an application definition is
+// inconsistent, listing every problem found
+type ValidationErrors []string
+
+func (v ValidationErrors) Error() string {
+	return fmt.Sprintf("invalid application definition:\n - %s",
+		strings.Join(v, "\n - "))
+}
+
+// Validate checks the application as deployed, after ApplyDefaults, for the
+// problems Marathon or Mesos would only report once deploying it. It returns
+// ValidationErrors listing all of them, the application is left untouched.
+func Validate(app *marathon.Application) error {
+	b, err := app.MarshalJSON()
+
+	if err != nil {
+		return err
+	}
+
+	var deployed marathon.Application
+
+	if err := deployed.UnmarshalJSON(b); err != nil {
+		return err
+	}
+
+	ApplyDefaults(&deployed)
+
+	if v := validate(&deployed); len(v) > 0 {
+		return v
+	}
+
+	return nil
+}
+
+func validate(app *marathon.Application) ValidationErrors {
+	var v ValidationErrors
+
+	ports, names, portsKnown := appPorts(app)
+
+	if app.HealthChecks != nil {
+		for i, h := range *app.HealthChecks {
+			v = append(v, validateHealthCheck(i, h, ports, portsKnown)...)
+		}
+	}
+
+	if app.ReadinessChecks != nil {
+		for i, r := range *app.ReadinessChecks {
+			name := r.PortName
+
+			// Marathon's default port name
+			if name == "" {
+				name = "http-api"
+			}
+
+			if !names[name] {
+				v = append(v, fmt.Sprintf("readinessChecks[%d] names port %q, which is not a port of the application", i, name))
+			}
+		}
+	}
+
+	v = append(v, validatePorts(app)...)
+	v = append(v, validateUpgradeStrategy(app)...)
+
+	if app.Fetch != nil {
+		for i, f := range *app.Fetch {
+			if !isFetchURI(f.URI) {
+				v = append(v, fmt.Sprintf("fetch[%d] uri %q is not a valid URL", i, f.URI))
+			}
+		}
+	}
+
+	if app.Uris != nil {
+		for i, uri := range *app.Uris {
+			if !isFetchURI(uri) {
+				v = append(v, fmt.Sprintf("uris[%d] %q is not a valid URL", i, uri))
+			}
+		}
+	}
+
+	return v
+}
+
+// appPorts returns how many ports the application has and their names. The
+// ports come from the docker portMappings, or the portDefinitions otherwise,
+// they are unknown when neither is set as Marathon then picks them.
+func appPorts(app *marathon.Application) (int, map[string]bool, bool) {
+	names := map[string]bool{}
+
+	if app.Container != nil && app.Container.Docker != nil && app.Container.Docker.PortMappings != nil {
+		mappings := *app.Container.Docker.PortMappings
+
+		for _, m := range mappings {
+			if m.Name != "" {
+				names[m.Name] = true
+			}
+		}
+
+		return len(mappings), names, true
+	}
+
+	if app.PortDefinitions != nil {
+		definitions := *app.PortDefinitions
+
+		for _, d := range definitions {
+			if d.Name != "" {
+				names[d.Name] = true
+			}
+		}
+
+		return len(definitions), names, true
+	}
+
+	return 0, names, false
+}
+
+func validateHealthCheck(i int, h marathon.HealthCheck, ports int, portsKnown bool) []string {
+	var v []string
+
+	protocol := strings.ToUpper(h.Protocol)
+
+	switch protocol {
+	case "COMMAND", "MESOS_COMMAND":
+		if h.Command == nil || strings.TrimSpace(h.Command.Value) == "" {
+			v = append(v, fmt.Sprintf("healthChecks[%d] %s check has no command", i, protocol))
+		}
+	case "MESOS_HTTP", "MESOS_HTTPS":
+		if h.Path == nil || *h.Path == "" {
+			v = append(v, fmt.Sprintf("healthChecks[%d] %s check has no path", i, protocol))
+		}
+		fallthrough
+	default:
+		index := 0
+
+		if h.PortIndex != nil {
+			index = *h.PortIndex
+		}
+
+		if h.Port == nil && portsKnown && (index < 0 || index >= ports) {
+			v = append(v, fmt.Sprintf("healthChecks[%d] portIndex %d is past the %d ports of the application", i, index, ports))
+		}
+	}
+
+	interval, timeout := h.IntervalSeconds, h.TimeoutSeconds
+
+	// Marathon defaults
+	if interval == 0 {
+		interval = 60
+	}
+
+	if timeout == 0 {
+		timeout = 20
+	}
+
+	if timeout >= interval {
+		v = append(v, fmt.Sprintf("healthChecks[%d] timeoutSeconds %d must be lower than intervalSeconds %d",
+			i, timeout, interval))
+	}
+
+	return v
+}
+
+// validatePorts reports the host ports an application requests twice, its
+// tasks could never be placed
+func validatePorts(app *marathon.Application) []string {
+	var v []string
+	seen := map[int]bool{}
+
+	if app.Container != nil && app.Container.Docker != nil && app.Container.Docker.PortMappings != nil {
+		for i, m := range *app.Container.Docker.PortMappings {
+			if m.HostPort == 0 {
+				continue
+			}
+
+			if seen[m.HostPort] {
+				v = append(v, fmt.Sprintf("portMappings[%d] hostPort %d is already used by the application", i, m.HostPort))
+			}
+
+			seen[m.HostPort] = true
+		}
+	}
+
+	if app.PortDefinitions != nil && app.RequirePorts != nil && *app.RequirePorts {
+		for i, d := range *app.PortDefinitions {
+			if d.Port == nil || *d.Port == 0 {
+				continue
+			}
+
+			if seen[*d.Port] {
+				v = append(v, fmt.Sprintf("portDefinitions[%d] port %d is already used by the application", i, *d.Port))
+			}
+
+			seen[*d.Port] = true
+		}
+	}
+
+	return v
+}
+
+// validateUpgradeStrategy checks the strategy bounds and that resident
+// applications, whose tasks are bound to their persistent volumes, are never
+// asked to run extra tasks or keep all of them during upgrades
+func validateUpgradeStrategy(app *marathon.Application) []string {
+	var v []string
+
+	s := app.UpgradeStrategy
+
+	if s == nil {
+		return nil
+	}
+
+	if c := s.MinimumHealthCapacity; c != nil && (*c < 0 || *c > 1) {
+		v = append(v, fmt.Sprintf("upgradeStrategy minimumHealthCapacity %v must be between 0 and 1", *c))
+	}
+
+	if c := s.MaximumOverCapacity; c != nil && (*c < 0 || *c > 1) {
+		v = append(v, fmt.Sprintf("upgradeStrategy maximumOverCapacity %v must be between 0 and 1", *c))
+	}
+
+	if !isResident(app) {
+		return v
+	}
+
+	if c := s.MinimumHealthCapacity; c == nil || *c > 0.5 {
+		v = append(v, "upgradeStrategy minimumHealthCapacity must be at most 0.5 for applications with persistent volumes")
+	}
+
+	if c := s.MaximumOverCapacity; c == nil || *c != 0 {
+		v = append(v, "upgradeStrategy maximumOverCapacity must be 0 for applications with persistent volumes")
+	}
+
+	return v
+}
+
+func isResident(app *marathon.Application) bool {
+	if app.Residency != nil {
+		return true
+	}
+
+	if app.Container == nil || app.Container.Volumes == nil {
+		return false
+	}
+
+	for _, volume := range *app.Container.Volumes {
+		if volume.Persistent != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isFetchURI reports whether the Mesos fetcher can get uri, a URL with a
+// scheme and a host or path, or an absolute local path
+func isFetchURI(uri string) bool {
+	if strings.HasPrefix(uri, "/") {
+		return true
+	}
+
+	u, err := url.Parse(uri)
+
+	return err == nil && u.Scheme != "" && (u.Host != "" || u.Path != "")
+}
@@ -0,0 +1,88 @@
+package deploy
+
+import (
+	"strings"
+	"testing"
+)
+
+var brokenApp = `
+id: quintoandar/app
+container:
+  type: DOCKER
+  volumes:
+    - containerPath: data
+      mode: RW
+      persistent: {size: 512}
+  docker:
+    image: quintoandar/app
+    network: BRIDGE
+    portMappings:
+      - containerPort: 8080
+        hostPort: 31000
+        name: http
+      - containerPort: 8081
+        hostPort: 31000
+healthChecks:
+  - protocol: MESOS_HTTP
+    portIndex: 2
+  - protocol: COMMAND
+  - protocol: TCP
+    intervalSeconds: 5
+readinessChecks:
+  - portName: admin
+upgradeStrategy:
+  minimumHealthCapacity: 1
+  maximumOverCapacity: 1.5
+fetch:
+  - uri: "docker.tar.gz"
+`
+
+func TestValidate(t *testing.T) {
+	err := Validate(parseApp(t, brokenApp))
+
+	problems, ok := err.(ValidationErrors)
+
+	if !ok {
+		t.Fatalf("Validate did not fail: %v", err)
+	}
+
+	for _, expected := range []string{
+		"healthChecks[0] MESOS_HTTP check has no path",
+		"healthChecks[0] portIndex 2 is past the 2 ports",
+		"healthChecks[1] COMMAND check has no command",
+		"healthChecks[2] timeoutSeconds 20 must be lower than intervalSeconds 5",
+		`readinessChecks[0] names port "admin"`,
+		"portMappings[1] hostPort 31000 is already used",
+		"maximumOverCapacity 1.5 must be between 0 and 1",
+		"minimumHealthCapacity must be at most 0.5 for applications with persistent volumes",
+		"maximumOverCapacity must be 0 for applications with persistent volumes",
+		`fetch[0] uri "docker.tar.gz" is not a valid URL`,
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("missing problem %q: \n%v", expected, err)
+		}
+	}
+
+	if len(problems) != 10 {
+		t.Fatalf("unexpected problems: \n%v", err)
+	}
+}
+
+func TestValidateValid(t *testing.T) {
+	valid := parseApp(t, app)
+
+	if err := Validate(valid); err != nil {
+		t.Fatalf("Validate failed: \n%v", err)
+	}
+
+	// the defaults were applied to a copy
+	if (*valid.HealthChecks)[0].IntervalSeconds != 0 || valid.Container.Docker.Parameters != nil {
+		t.Fatalf("Validate changed the application: \n%+v", valid)
+	}
+
+	for _, uri := range []string{"https://example.com/app.tar.gz", "hdfs://namenode/app.tar.gz", "/opt/app.tar.gz"} {
+		if !isFetchURI(uri) {
+			t.Fatalf("valid uri %q was rejected", uri)
+		}
+	}
+}
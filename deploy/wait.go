@@ -0,0 +1,111 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	marathon "github.com/fbcbarbosa/go-marathon"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// waitOnDeployment waits for the deployment to finish, like
+// marathon.WaitOnDeployment but returning early when c is done or the crash
+// loop, if any, is detected. The progress, if any, is reported every interval.
+func waitOnDeployment(c context.Context, client Client, id string, timeout time.Duration,
+	progress *progress, interval time.Duration, crashes *crashLoop) error {
+
+	if found, err := client.HasDeployment(id); err != nil || !found {
+		return err
+	}
+
+	tick := time.NewTicker(deploymentPollInterval)
+	defer tick.Stop()
+	tout := time.After(timeout)
+
+	var report <-chan time.Time
+
+	if progress != nil && interval > 0 {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		report = t.C
+	}
+
+	for {
+		select {
+
+		case <-tick.C:
+
+			if found, err := client.HasDeployment(id); err != nil || !found {
+				return err
+			}
+
+			if crashes != nil {
+				if err := crashes.check(); err != nil {
+					return err
+				}
+			}
+
+		case <-report:
+			progress.report()
+
+		case <-tout:
+			return marathon.ErrTimeoutError
+
+		case <-c.Done():
+			return c.Err()
+		}
+	}
+}
+
+func waitOnTasksToDie(c context.Context, client Client, name, version string, timeout time.Duration) error {
+	if val, err := areTasksDead(client, name, version); err != nil || val {
+		return err
+	}
+
+	tick := time.NewTicker(taskPollInterval)
+	defer tick.Stop()
+	tout := time.After(timeout)
+
+	for {
+		select {
+
+		case <-tick.C:
+
+			if val, err := areTasksDead(client, name, version); err != nil || val {
+				return err
+			}
+
+		case <-tout:
+			return errors.New("timed out")
+
+		case <-c.Done():
+			return c.Err()
+		}
+	}
+}
+
+func areTasksDead(client Client, name, version string) (bool, error) {
+
+	tasks, err := client.Tasks(name)
+
+	if err != nil {
+		return false, err
+	}
+
+	return !containsVersion(tasks.Tasks, version), nil
+}
+
+func containsVersion(tasks []marathon.Task, version string) bool {
+	for _, t := range tasks {
+		if t.Version == version {
+			log.WithFields(log.Fields{
+				"task":    t.ID,
+				"version": version,
+			}).Info("waiting for failed task to die")
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Log output formats
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// configureLogging sets the log format and level, it is independent of the
+// debug flag which only dumps the Marathon API traffic
+func configureLogging(format, level string) error {
+	lvl, err := log.ParseLevel(level)
+
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case logFormatText:
+		log.SetFormatter(&log.TextFormatter{})
+	case logFormatJSON:
+		log.SetFormatter(&log.JSONFormatter{})
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+
+	// errors are logged as "err" whether or not they use WithError
+	log.ErrorKey = "err"
+	log.SetLevel(lvl)
+	log.SetOutput(os.Stderr)
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+func TestConfigureLoggingJSON(t *testing.T) {
+	defer configureLogging(logFormatText, "info")
+
+	if err := configureLogging(logFormatJSON, "debug"); err != nil {
+		t.Fatalf("configureLogging failed: \n%v", err)
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+
+	log.WithField("app", "/quintoandar/app").WithError(errors.New("failed")).Debug("deploying")
+
+	var entry map[string]interface{}
+
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log entry is not JSON: \n%s", buf.String())
+	}
+
+	if entry["app"] != "/quintoandar/app" || entry["err"] != "failed" || entry["level"] != "debug" {
+		t.Fatalf("unexpected log entry: \n%v", entry)
+	}
+}
+
+func TestConfigureLoggingInvalid(t *testing.T) {
+	defer configureLogging(logFormatText, "info")
+
+	if err := configureLogging("xml", "info"); err == nil {
+		t.Fatalf("configureLogging accepted an unknown format")
+	}
+
+	if err := configureLogging(logFormatText, "verbose"); err == nil {
+		t.Fatalf("configureLogging accepted an unknown level")
+	}
+}
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
+	"github.com/quintoandar/drone-marathon/deploy"
+
 	log "github.com/Sirupsen/logrus"
 	"github.com/urfave/cli"
 )
@@ -14,6 +20,74 @@ func main() {
 	app.Name = "Marathon deploy Drone plugin"
 	app.Usage = "marathon deploy Drone plugin"
 	app.Action = run
+	app.Before = func(c *cli.Context) error {
+		return configureLogging(c.String("log_format"), c.String("log_level"))
+	}
+	app.Commands = []cli.Command{
+		{
+			Name:   "render",
+			Usage:  "print the marathonfile merged with its overlays",
+			Action: render,
+		},
+		{
+			Name:      "migrate",
+			Usage:     "convert the marathonfile and its overlays, or the given files, to the Marathon 1.5 networking format",
+			ArgsUsage: "[file...]",
+			Action:    migrate,
+		},
+		{
+			Name:      "fmt",
+			Usage:     "rewrite the marathonfile and its overlays, or the given files, in canonical YAML",
+			ArgsUsage: "[file...]",
+			Action:    format,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "check",
+					Usage: "only fail when files are not formatted",
+				},
+			},
+		},
+		{
+			Name:      "export",
+			Usage:     "print the given application as a marathonfile, or write the applications under the given groups to a directory",
+			ArgsUsage: "[id...]",
+			Action:    export,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "format",
+					Usage: "output format: yaml or json",
+					Value: "yaml",
+				},
+				cli.StringFlag{
+					Name:  "dir",
+					Usage: "write one marathonfile per application to this directory",
+				},
+			},
+		},
+		{
+			Name:      "backup",
+			Usage:     "write the definitions of every app and pod of the cluster to a directory",
+			ArgsUsage: "dir",
+			Action:    backup,
+		},
+		{
+			Name:      "restore",
+			Usage:     "create the apps and pods of a backup missing from the cluster",
+			ArgsUsage: "dir",
+			Action:    restore,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "prefix",
+					Usage: "only restore the definitions under this group",
+				},
+			},
+		},
+		{
+			Name:   "gc",
+			Usage:  "delete the applications under the destroy prefix past their TTL",
+			Action: gc,
+		},
+	}
 	app.Flags = []cli.Flag{
 
 		cli.StringFlag{
@@ -22,6 +96,64 @@ func main() {
 			Value:  "http://master.mesos:8080",
 			EnvVar: "PLUGIN_SERVER",
 		},
+		cli.StringFlag{
+			Name:   "metronome",
+			Usage:  "metronome server",
+			Value:  "http://leader.mesos/service/metronome",
+			EnvVar: "PLUGIN_METRONOME",
+		},
+		cli.StringFlag{
+			Name:   "dcos_token",
+			Usage:  "DC/OS authentication token for the marathon and metronome servers",
+			EnvVar: "PLUGIN_DCOS_TOKEN,DCOS_TOKEN",
+		},
+		cli.BoolFlag{
+			Name:   "job_run",
+			Usage:  "if true will run the Metronome job once deployed and wait for it to finish",
+			EnvVar: "PLUGIN_JOB_RUN",
+		},
+		cli.StringFlag{
+			Name:   "mode",
+			Usage:  "deploy the marathonfile, scale, restart or destroy the application, deploy a Metronome job or collect garbage",
+			Value:  modeDeploy,
+			EnvVar: "PLUGIN_MODE",
+		},
+		cli.StringFlag{
+			Name:   "app_id",
+			Usage:  "application to scale, restart or destroy (defaults to the marathonfile id)",
+			EnvVar: "PLUGIN_APP_ID",
+		},
+		cli.StringFlag{
+			Name:   "instances",
+			Usage:  "number of instances (5) or change to it (+2, -1) in scale mode",
+			EnvVar: "PLUGIN_INSTANCES",
+		},
+		cli.StringFlag{
+			Name:   "destroy_prefix",
+			Usage:  "group the apps and groups to destroy must be under",
+			EnvVar: "PLUGIN_DESTROY_PREFIX",
+		},
+		cli.BoolFlag{
+			Name:   "prune_groups",
+			Usage:  "if true will remove the groups left empty by destroy",
+			EnvVar: "PLUGIN_PRUNE_GROUPS",
+		},
+		cli.DurationFlag{
+			Name:   "ttl",
+			Usage:  "labels deployed applications to expire after it, gc deletes expired applications",
+			EnvVar: "PLUGIN_TTL",
+		},
+		cli.BoolFlag{
+			Name:   "dry_run",
+			Usage:  "if true gc and restore only log the applications they would delete or create",
+			EnvVar: "PLUGIN_DRY_RUN",
+		},
+		cli.IntFlag{
+			Name:   "max_deletions",
+			Usage:  "gc fails without deleting anything when more applications expired (0 disables the limit)",
+			Value:  10,
+			EnvVar: "PLUGIN_MAX_DELETIONS",
+		},
 		cli.StringFlag{
 			Name:   "marathonfile",
 			Usage:  "application marathon file",
@@ -32,20 +164,156 @@ func main() {
 			Usage:  "application in-line config",
 			EnvVar: "PLUGIN_APP_CONFIG",
 		},
+		cli.StringSliceFlag{
+			Name:   "overlays",
+			Usage:  "ordered list of files merged on top of the marathonfile",
+			EnvVar: "PLUGIN_OVERLAYS",
+		},
+		cli.StringFlag{
+			Name:   "overlay_merge",
+			Usage:  "overlay merge semantics (strategic or merge-patch)",
+			Value:  deploy.MergeStrategic,
+			EnvVar: "PLUGIN_OVERLAY_MERGE",
+		},
+		cli.BoolFlag{
+			Name:   "template",
+			Usage:  "if true will render marathonfiles with Go templates",
+			EnvVar: "PLUGIN_TEMPLATE",
+		},
+		cli.StringFlag{
+			Name:   "policy",
+			Usage:  "policy file the application must comply with",
+			EnvVar: "PLUGIN_POLICY",
+		},
+		cli.StringFlag{
+			Name:   "policy_mode",
+			Usage:  "policy violations either fail the deploy (enforce) or are logged (warn)",
+			Value:  deploy.PolicyEnforce,
+			EnvVar: "PLUGIN_POLICY_MODE",
+		},
+		cli.StringFlag{
+			Name:   "report",
+			Usage:  "file to write the JSON deploy report to",
+			EnvVar: "PLUGIN_REPORT",
+		},
+		cli.StringSliceFlag{
+			Name:   "webhooks",
+			Usage:  "webhook URLs notified of deploy lifecycle events",
+			EnvVar: "PLUGIN_WEBHOOKS",
+		},
+		cli.StringFlag{
+			Name:   "webhook_format",
+			Usage:  "webhook payload format (json or slack)",
+			Value:  deploy.FormatJSON,
+			EnvVar: "PLUGIN_WEBHOOK_FORMAT",
+		},
 		cli.StringFlag{
 			Name:   "timeout",
-			Usage:  "deployment timeout in minutes (applies to rollbacks too)",
+			Usage:  "deployment timeout as a duration (90s, 10m) or in minutes",
 			Value:  "5",
 			EnvVar: "PLUGIN_TIMEOUT",
 		},
+		cli.DurationFlag{
+			Name:   "drain_timeout",
+			Usage:  "time to wait on the tasks of a failed deployment to die (defaults to timeout)",
+			EnvVar: "PLUGIN_DRAIN_TIMEOUT",
+		},
+		cli.DurationFlag{
+			Name:   "rollback_timeout",
+			Usage:  "rollback deployment timeout (defaults to timeout)",
+			EnvVar: "PLUGIN_ROLLBACK_TIMEOUT",
+		},
+		cli.StringFlag{
+			Name:   "pre_deploy",
+			Usage:  "command run once with the application image before updating it, e.g. migrations",
+			EnvVar: "PLUGIN_PRE_DEPLOY",
+		},
+		cli.DurationFlag{
+			Name:   "pre_deploy_timeout",
+			Usage:  "pre-deploy command timeout (defaults to timeout)",
+			EnvVar: "PLUGIN_PRE_DEPLOY_TIMEOUT",
+		},
+		cli.DurationFlag{
+			Name:   "deadline",
+			Usage:  "overall deploy deadline budgeted across the deployment, drain and rollback",
+			EnvVar: "PLUGIN_DEADLINE",
+		},
+		cli.DurationFlag{
+			Name:   "progress_interval",
+			Usage:  "how often to log the deployment progress (0 disables it)",
+			Value:  10 * time.Second,
+			EnvVar: "PLUGIN_PROGRESS_INTERVAL",
+		},
+		cli.DurationFlag{
+			Name:   "observe_window",
+			Usage:  "how long to watch the application once deployed before succeeding (0 disables it)",
+			EnvVar: "PLUGIN_OBSERVE_WINDOW",
+		},
+		cli.IntFlag{
+			Name:   "observe_min_healthy",
+			Usage:  "minimum healthy tasks during the observation window (defaults to all instances)",
+			EnvVar: "PLUGIN_OBSERVE_MIN_HEALTHY",
+		},
+		cli.IntFlag{
+			Name:   "crash_loop_threshold",
+			Usage:  "fail the deployment once this many new tasks failed within the crash loop window (0 disables it)",
+			EnvVar: "PLUGIN_CRASH_LOOP_THRESHOLD",
+		},
+		cli.DurationFlag{
+			Name:   "crash_loop_window",
+			Usage:  "window in which task failures count towards the crash loop threshold",
+			Value:  2 * time.Minute,
+			EnvVar: "PLUGIN_CRASH_LOOP_WINDOW",
+		},
+		cli.BoolFlag{
+			Name:   "reset_delay",
+			Usage:  "reset the application launch delay before deploying",
+			EnvVar: "PLUGIN_RESET_DELAY",
+		},
 		cli.BoolTFlag{
 			Name:   "rollback",
 			Usage:  "if true will attempt to rollback failed deployments",
 			EnvVar: "PLUGIN_ROLLBACK",
 		},
+		cli.StringFlag{
+			Name:   "on_cancel",
+			Usage:  "action on the in-flight deployment when interrupted (cancel, leave or rollback)",
+			Value:  deploy.CancelDeployment,
+			EnvVar: "PLUGIN_ON_CANCEL",
+		},
+		cli.DurationFlag{
+			Name:   "cancel_grace",
+			Usage:  "time allowed for the on_cancel action to complete",
+			Value:  20 * time.Second,
+			EnvVar: "PLUGIN_CANCEL_GRACE",
+		},
+		cli.DurationFlag{
+			Name:   "retry_timeout",
+			Usage:  "maximum time spent retrying transient Marathon API failures (0 disables retries)",
+			Value:  time.Minute,
+			EnvVar: "PLUGIN_RETRY_TIMEOUT",
+		},
+		cli.StringFlag{
+			Name:   "networking",
+			Usage:  "networking format sent to marathon: auto (from the server version), legacy or networks",
+			Value:  "auto",
+			EnvVar: "PLUGIN_NETWORKING",
+		},
+		cli.StringFlag{
+			Name:   "log_format",
+			Usage:  "log output format (text or json)",
+			Value:  logFormatText,
+			EnvVar: "PLUGIN_LOG_FORMAT",
+		},
+		cli.StringFlag{
+			Name:   "log_level",
+			Usage:  "log level (debug, info, warning or error)",
+			Value:  "info",
+			EnvVar: "PLUGIN_LOG_LEVEL",
+		},
 		cli.BoolFlag{
 			Name:   "debug",
-			Usage:  "if true will print debug logs",
+			Usage:  "if true will dump the Marathon API traffic",
 			EnvVar: "PLUGIN_DEBUG",
 		},
 	}
@@ -55,24 +323,196 @@ func main() {
 }
 
 func run(c *cli.Context) error {
-	timeout, err := strconv.Atoi(c.String("timeout"))
+	plugin, err := newPlugin(c)
+
+	if err != nil {
+		return err
+	}
+
+	return plugin.ExecContext(signalContext())
+}
+
+// signalContext returns a context cancelled on SIGINT or SIGTERM, which Drone
+// sends when a build is cancelled or times out
+func signalContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		s := <-signals
+		log.WithField("signal", s).Warning("received signal, interrupting deploy")
+		cancel()
+	}()
+
+	return ctx
+}
+
+func render(c *cli.Context) error {
+	plugin, err := newPlugin(c.Parent())
+
+	if err != nil {
+		return err
+	}
+
+	data, err := plugin.input().Render()
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(data)
+	return nil
+}
+
+func gc(c *cli.Context) error {
+	plugin, err := newPlugin(c.Parent())
+
+	if err != nil {
+		return err
+	}
+
+	return plugin.collectGarbage(signalContext())
+}
+
+func migrate(c *cli.Context) error {
+	plugin, err := newPlugin(c.Parent())
+
+	if err != nil {
+		return err
+	}
+
+	return plugin.migrate(c.Args())
+}
+
+func format(c *cli.Context) error {
+	plugin, err := newPlugin(c.Parent())
+
+	if err != nil {
+		return err
+	}
+
+	return plugin.format(c.Args(), c.Bool("check"))
+}
+
+func export(c *cli.Context) error {
+	plugin, err := newPlugin(c.Parent())
+
+	if err != nil {
+		return err
+	}
+
+	data, err := plugin.export(signalContext(), c.Args(), c.String("format"), c.String("dir"))
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(data)
+	return nil
+}
+
+func backup(c *cli.Context) error {
+	plugin, err := newPlugin(c.Parent())
+
+	if err != nil {
+		return err
+	}
+
+	return plugin.backup(signalContext(), c.Args().First())
+}
+
+func restore(c *cli.Context) error {
+	plugin, err := newPlugin(c.Parent())
+
+	if err != nil {
+		return err
+	}
+
+	return plugin.restore(signalContext(), c.Args().First(), c.String("prefix"))
+}
+
+// newPlugin builds a Plugin from the global flags
+func newPlugin(c *cli.Context) (Plugin, error) {
+	timeout, err := parseTimeout(c.String("timeout"))
 
 	if err != nil {
 		log.WithFields(log.Fields{
 			"timeout": c.String("timeout"),
-			"error":   err,
+			"err":     err,
 		}).Error("invalid timeout configuration")
-		return err
+		return Plugin{}, err
+	}
+
+	webhookFormat, err := parseWebhookFormat(c.String("webhook_format"))
+
+	if err != nil {
+		log.WithError(err).Error("invalid webhook format configuration")
+		return Plugin{}, err
 	}
 
-	plugin := Plugin{
-		Server:       c.String("server"),
-		Marathonfile: c.String("marathonfile"),
-		AppConfig:    c.String("app_config"),
-		Timeout:      time.Duration(timeout) * time.Minute,
-		Rollback:     c.BoolT("rollback"),
-		Debug:        c.Bool("debug"),
+	return Plugin{
+		Server:             c.String("server"),
+		Metronome:          c.String("metronome"),
+		Token:              c.String("dcos_token"),
+		JobRun:             c.Bool("job_run"),
+		Mode:               c.String("mode"),
+		AppID:              c.String("app_id"),
+		Instances:          c.String("instances"),
+		DestroyPrefix:      c.String("destroy_prefix"),
+		PruneGroups:        c.Bool("prune_groups"),
+		TTL:                c.Duration("ttl"),
+		DryRun:             c.Bool("dry_run"),
+		MaxDeletions:       c.Int("max_deletions"),
+		Marathonfile:       c.String("marathonfile"),
+		AppConfig:          c.String("app_config"),
+		Overlays:           c.StringSlice("overlays"),
+		OverlayMerge:       c.String("overlay_merge"),
+		Template:           c.Bool("template"),
+		Policy:             c.String("policy"),
+		PolicyMode:         c.String("policy_mode"),
+		Report:             c.String("report"),
+		Webhooks:           c.StringSlice("webhooks"),
+		WebhookFormat:      webhookFormat,
+		Timeout:            timeout,
+		DrainTimeout:       c.Duration("drain_timeout"),
+		RollbackTimeout:    c.Duration("rollback_timeout"),
+		Deadline:           c.Duration("deadline"),
+		PreDeploy:          c.String("pre_deploy"),
+		PreDeployTimeout:   c.Duration("pre_deploy_timeout"),
+		ProgressInterval:   c.Duration("progress_interval"),
+		ObserveWindow:      c.Duration("observe_window"),
+		ObserveMinHealthy:  c.Int("observe_min_healthy"),
+		CrashLoopThreshold: c.Int("crash_loop_threshold"),
+		CrashLoopWindow:    c.Duration("crash_loop_window"),
+		Rollback:           c.BoolT("rollback"),
+		ResetDelay:         c.Bool("reset_delay"),
+		OnCancel:           c.String("on_cancel"),
+		CancelGrace:        c.Duration("cancel_grace"),
+		Networking:         c.String("networking"),
+		RetryTimeout:       c.Duration("retry_timeout"),
+		Debug:              c.Bool("debug"),
+	}, nil
+}
+
+// parseTimeout parses a Go duration, plain integers are minutes
+func parseTimeout(value string) (time.Duration, error) {
+	if minutes, err := strconv.Atoi(value); err == nil {
+		return time.Duration(minutes) * time.Minute, nil
+	}
+
+	return time.ParseDuration(value)
+}
+
+// parseWebhookFormat checks the webhook payload format, empty is JSON
+func parseWebhookFormat(value string) (string, error) {
+	switch value {
+	case deploy.FormatJSON, "":
+		return deploy.FormatJSON, nil
+	case deploy.FormatSlack:
+		return value, nil
 	}
 
-	return plugin.Exec()
+	return "", fmt.Errorf("unknown webhook format %q", value)
 }
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeout(t *testing.T) {
+	cases := map[string]time.Duration{
+		"5":   5 * time.Minute,
+		"90s": 90 * time.Second,
+		"10m": 10 * time.Minute,
+	}
+
+	for value, expected := range cases {
+		timeout, err := parseTimeout(value)
+
+		if err != nil || timeout != expected {
+			t.Fatalf("parseTimeout(%q) = %v, %v", value, timeout, err)
+		}
+	}
+
+	if _, err := parseTimeout("five"); err == nil {
+		t.Fatalf("parseTimeout accepted an invalid timeout")
+	}
+}
+
+func TestParseWebhookFormat(t *testing.T) {
+	cases := map[string]string{
+		"":      "json",
+		"json":  "json",
+		"slack": "slack",
+	}
+
+	for value, expected := range cases {
+		format, err := parseWebhookFormat(value)
+
+		if err != nil || format != expected {
+			t.Fatalf("parseWebhookFormat(%q) = %q, %v", value, format, err)
+		}
+	}
+
+	for _, value := range []string{"teams", "Slack"} {
+		if _, err := parseWebhookFormat(value); err == nil {
+			t.Fatalf("parseWebhookFormat accepted %q", value)
+		}
+	}
+}
@@ -0,0 +1,1047 @@
+// Package marathontest provides an in-process fake Marathon server for end to
+// end tests. It keeps apps, versions, deployments and tasks in memory and
+// advances deployments on a schedule scripted per app with a Behavior.
+package marathontest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghodss/yaml"
+)
+
+// Behavior scripts how the deployments of an app progress
+type Behavior struct {
+	// Duration is how long deployments take to finish
+	Duration time.Duration
+	// Hang keeps deployments running until they are cancelled
+	Hang bool
+	// Unhealthy makes tasks of new versions fail their health checks, which
+	// keeps deployments running until they are cancelled
+	Unhealthy bool
+	// Crash makes tasks of new versions fail as soon as they are launched,
+	// recording the failure, and get relaunched, which keeps deployments
+	// running until they are cancelled. The app is then delayed in the launch
+	// queue, holding back its other deployments until the delay is reset.
+	Crash bool
+	// Exit, if set, is the terminal state (TASK_FINISHED, TASK_FAILED...)
+	// tasks reach once they have been running for Duration, outside of
+	// deployments. Exited tasks are not relaunched.
+	Exit string
+}
+
+// Server is a fake Marathon server
+type Server struct {
+	*httptest.Server
+
+	// Version is the Marathon version reported by /v2/info
+	Version string
+
+	mu          sync.Mutex
+	clock       time.Time
+	ids         int
+	apps        map[string]*app
+	groups      map[string]bool
+	deployments map[string]*deployment
+	behaviors   map[string]Behavior
+	pods        map[string]map[string]interface{}
+}
+
+type app struct {
+	definition      map[string]interface{}
+	versions        []map[string]interface{}
+	tasks           []*task
+	lastTaskFailure map[string]interface{}
+	// delay is when the app can launch tasks again after crashing
+	delay time.Time
+}
+
+type task struct {
+	id      string
+	version string
+	state   string
+	healthy bool
+	staged  time.Time
+}
+
+type deployment struct {
+	id       string
+	version  string
+	app      string
+	action   string
+	started  time.Time
+	behavior Behavior
+	// target is the definition being deployed, nil when stopping the app
+	target map[string]interface{}
+	// group is set when deleting the group app
+	group bool
+}
+
+// NewServer starts a fake Marathon server, it must be closed when done
+func NewServer() *Server {
+	s := &Server{
+		Version:     "1.4.8",
+		clock:       time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+		apps:        map[string]*app{},
+		groups:      map[string]bool{},
+		deployments: map[string]*deployment{},
+		behaviors:   map[string]Behavior{},
+		pods:        map[string]map[string]interface{}{},
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// SetBehavior scripts how the next deployments of the app progress, rolling
+// back to a version deployed earlier is not affected
+func (s *Server) SetBehavior(id string, b Behavior) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.behaviors[normalizeID(id)] = b
+}
+
+// AddApp creates an app from a YAML or JSON definition with all of its
+// instances running and healthy, as if it had been deployed earlier
+func (s *Server) AddApp(definition string) (version string, err error) {
+	var def map[string]interface{}
+
+	if err := yaml.Unmarshal([]byte(definition), &def); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := normalizeID(fmt.Sprint(def["id"]))
+	def["id"] = id
+	def["version"] = s.nextVersion()
+
+	a := &app{definition: def}
+	a.versions = append(a.versions, def)
+	a.tasks = s.launch(id, def, true)
+	s.apps[id] = a
+	s.addGroups(id)
+
+	return def["version"].(string), nil
+}
+
+// AddPod creates a pod from a YAML or JSON definition
+func (s *Server) AddPod(definition string) error {
+	var def map[string]interface{}
+
+	if err := yaml.Unmarshal([]byte(definition), &def); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addPod(def)
+	return nil
+}
+
+// HasPod reports whether the pod exists
+func (s *Server) HasPod(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.pods[normalizeID(id)]
+	return ok
+}
+
+// AppVersion returns the current version of the app
+func (s *Server) AppVersion(id string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance()
+
+	if a, ok := s.apps[normalizeID(id)]; ok {
+		return a.definition["version"].(string)
+	}
+
+	return ""
+}
+
+// HasApp reports whether the app exists
+func (s *Server) HasApp(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance()
+
+	_, ok := s.apps[normalizeID(id)]
+	return ok
+}
+
+// HasGroup reports whether the group exists
+func (s *Server) HasGroup(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance()
+
+	return s.groups[normalizeID(id)]
+}
+
+// Deployments returns the number of running deployments
+func (s *Server) Deployments() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance()
+
+	return len(s.deployments)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.advance()
+
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	force := r.URL.Query().Get("force") == "true"
+
+	switch {
+	case path == "/ping":
+		w.Write([]byte("pong"))
+
+	case path == "/v2/info":
+		reply(w, http.StatusOK, map[string]interface{}{
+			"name":    "marathon",
+			"version": s.Version,
+		})
+
+	case path == "/v2/queue":
+		s.queue(w)
+
+	case strings.HasPrefix(path, "/v2/queue/") && strings.HasSuffix(path, "/delay") && r.Method == http.MethodDelete:
+		s.resetDelay(w, normalizeID(strings.TrimSuffix(strings.TrimPrefix(path, "/v2/queue"), "/delay")))
+
+	case path == "/v2/deployments" && r.Method == http.MethodGet:
+		s.listDeployments(w)
+
+	case strings.HasPrefix(path, "/v2/deployments/") && r.Method == http.MethodDelete:
+		s.cancelDeployment(w, strings.TrimPrefix(path, "/v2/deployments/"), force)
+
+	case path == "/v2/apps" && r.Method == http.MethodGet:
+		s.listApps(w, r.URL.Query().Get("id"))
+
+	case path == "/v2/apps" && r.Method == http.MethodPost:
+		s.createApp(w, r)
+
+	case path == "/v2/pods":
+		s.servePods(w, r)
+
+	case path == "/v2/groups" || strings.HasPrefix(path, "/v2/groups/"):
+		s.serveGroup(w, r, normalizeID(strings.TrimPrefix(path, "/v2/groups")))
+
+	case strings.HasPrefix(path, "/v2/apps/"):
+		s.serveApp(w, r, strings.TrimPrefix(path, "/v2/apps"), force)
+
+	default:
+		notFound(w, "unknown resource %s", path)
+	}
+}
+
+func (s *Server) serveApp(w http.ResponseWriter, r *http.Request, path string, force bool) {
+	id, resource, version := path, "", ""
+
+	if i := strings.Index(path, "/versions/"); i >= 0 {
+		id, resource, version = path[:i], "version", path[i+len("/versions/"):]
+	} else {
+		for _, suffix := range []string{"/versions", "/tasks", "/restart"} {
+			if strings.HasSuffix(path, suffix) {
+				id, resource = strings.TrimSuffix(path, suffix), suffix[1:]
+				break
+			}
+		}
+	}
+
+	id = normalizeID(id)
+	a, exists := s.apps[id]
+
+	if !exists && !(r.Method == http.MethodPut && resource == "") {
+		notFound(w, "App '%s' does not exist", id)
+		return
+	}
+
+	switch {
+	case resource == "" && r.Method == http.MethodGet:
+		reply(w, http.StatusOK, map[string]interface{}{"app": s.status(id, a)})
+
+	case resource == "" && r.Method == http.MethodPut:
+		s.updateApp(w, r, id, force)
+
+	case resource == "" && r.Method == http.MethodDelete:
+		if s.locked(w, id, force) {
+			return
+		}
+		reply(w, http.StatusOK, s.deploy(id, "StopApplication", nil, false))
+
+	case resource == "tasks" && r.Method == http.MethodGet:
+		reply(w, http.StatusOK, map[string]interface{}{"tasks": s.tasks(id, a)})
+
+	case resource == "versions" && r.Method == http.MethodGet:
+		var versions []string
+		for i := len(a.versions) - 1; i >= 0; i-- {
+			versions = append(versions, a.versions[i]["version"].(string))
+		}
+		reply(w, http.StatusOK, map[string]interface{}{"versions": versions})
+
+	case resource == "version" && r.Method == http.MethodGet:
+		if def := a.version(version); def != nil {
+			reply(w, http.StatusOK, def)
+			return
+		}
+		notFound(w, "App '%s' does not exist in version %s", id, version)
+
+	case resource == "restart" && r.Method == http.MethodPost:
+		if s.locked(w, id, force) {
+			return
+		}
+		reply(w, http.StatusOK, s.deploy(id, "RestartApplication", copyDefinition(a.definition), false))
+
+	default:
+		reply(w, http.StatusMethodNotAllowed, map[string]string{"message": "method not allowed"})
+	}
+}
+
+// updateApp handles PUT /v2/apps/:id, a body holding only a version rolls the
+// app back to it, any other body is merged into the current definition
+func (s *Server) updateApp(w http.ResponseWriter, r *http.Request, id string, force bool) {
+	var body map[string]interface{}
+
+	if !decode(w, r, &body) || s.locked(w, id, force) {
+		return
+	}
+
+	a, exists := s.apps[id]
+	target := map[string]interface{}{}
+
+	if exists {
+		target = copyDefinition(a.definition)
+	}
+
+	v, rollback := body["version"].(string)
+	rollback = rollback && len(body) == 1
+
+	if rollback {
+		if !exists {
+			notFound(w, "App '%s' does not exist", id)
+			return
+		}
+		if target = a.version(v); target == nil {
+			notFound(w, "App '%s' does not exist in version %s", id, v)
+			return
+		}
+		target = copyDefinition(target)
+	} else {
+		for k, v := range body {
+			target[k] = v
+		}
+	}
+
+	target["id"] = id
+
+	if !exists {
+		s.apps[id] = &app{definition: target}
+		s.addGroups(id)
+	}
+
+	reply(w, http.StatusOK, s.deploy(id, "RestartApplication", target, rollback))
+}
+
+func (s *Server) createApp(w http.ResponseWriter, r *http.Request) {
+	var body map[string]interface{}
+
+	if !decode(w, r, &body) {
+		return
+	}
+
+	id := normalizeID(fmt.Sprint(body["id"]))
+
+	if _, exists := s.apps[id]; exists {
+		reply(w, http.StatusConflict, map[string]string{
+			"message": fmt.Sprintf("An app with id [%s] already exists.", id),
+		})
+		return
+	}
+
+	body["id"] = id
+	s.apps[id] = &app{definition: body}
+	s.addGroups(id)
+	s.deploy(id, "StartApplication", body, false)
+
+	reply(w, http.StatusCreated, body)
+}
+
+// locked replies 409 when the app is being deployed, forcing cancels the
+// running deployments instead
+func (s *Server) locked(w http.ResponseWriter, id string, force bool) bool {
+	var ids []map[string]string
+
+	for _, d := range s.deployments {
+		if d.app != id {
+			continue
+		}
+
+		if force {
+			delete(s.deployments, d.id)
+			continue
+		}
+
+		ids = append(ids, map[string]string{"id": d.id})
+	}
+
+	if len(ids) == 0 {
+		return false
+	}
+
+	reply(w, http.StatusConflict, map[string]interface{}{
+		"message":     "App is locked by one or more deployments. Override with the option '?force=true'.",
+		"deployments": ids,
+	})
+	return true
+}
+
+// deploy starts a deployment of target, a new version of the app. Rolling
+// back to a version deployed earlier ignores the app behavior as that version
+// is known to be healthy.
+func (s *Server) deploy(id, action string, target map[string]interface{}, rollback bool) map[string]string {
+	s.ids++
+
+	d := &deployment{
+		id:      fmt.Sprintf("%08x-0000-4000-8000-000000000000", s.ids),
+		version: s.nextVersion(),
+		app:     id,
+		action:  action,
+		started: time.Now(),
+		target:  target,
+	}
+
+	if !rollback {
+		d.behavior = s.behaviors[id]
+	}
+
+	if target != nil {
+		target["version"] = d.version
+		a := s.apps[id]
+		a.definition = target
+		a.versions = append(a.versions, target)
+	}
+
+	s.deployments[d.id] = d
+	s.advance()
+
+	return map[string]string{"deploymentId": d.id, "version": d.version}
+}
+
+func (s *Server) cancelDeployment(w http.ResponseWriter, id string, force bool) {
+	d, ok := s.deployments[id]
+
+	if !ok {
+		notFound(w, "DeploymentPlan %s does not exist", id)
+		return
+	}
+
+	delete(s.deployments, id)
+	a, exists := s.apps[d.app]
+
+	// deleting groups is not rolled back
+	if !exists {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	// unhealthy tasks of the cancelled version are killed
+	var tasks []*task
+
+	for _, t := range a.tasks {
+		if t.version != d.version || t.healthy {
+			tasks = append(tasks, t)
+		}
+	}
+
+	a.tasks = tasks
+
+	if force {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	// without force Marathon rolls back to the previous version
+	if prev := a.previous(d.version); prev != nil {
+		reply(w, http.StatusOK, s.deploy(d.app, "RestartApplication", copyDefinition(prev), true))
+		return
+	}
+
+	reply(w, http.StatusOK, s.deploy(d.app, "StopApplication", nil, false))
+}
+
+// advance moves deployments forward according to their behavior
+func (s *Server) advance() {
+	now := time.Now()
+
+	for _, d := range s.deployments {
+		a := s.apps[d.app]
+		done := !d.behavior.Hang && !d.behavior.Unhealthy && !d.behavior.Crash &&
+			now.Sub(d.started) >= d.behavior.Duration
+
+		if d.target == nil {
+			if done {
+				s.remove(d.app, d.group)
+				delete(s.deployments, d.id)
+			}
+			continue
+		}
+
+		if d.behavior.Crash {
+			s.crash(d.app, a, d.version, now)
+		} else if now.Before(a.delay) {
+			continue
+		}
+
+		// replace the tasks of other versions once the deployment is done,
+		// the task launched during the deployment keeps running
+		if done {
+			tasks := s.launch(d.app, d.target, true)
+
+			for _, t := range a.tasks {
+				if t.version == d.version && len(tasks) > 0 {
+					t.state, t.healthy = "TASK_RUNNING", true
+					tasks[0] = t
+				}
+			}
+
+			a.tasks = tasks
+			delete(s.deployments, d.id)
+			continue
+		}
+
+		launched := false
+
+		for _, t := range a.tasks {
+			launched = launched || t.version == d.version
+		}
+
+		if !launched {
+			t := s.launch(d.app, d.target, false)
+			if len(t) > 0 {
+				a.tasks = append(a.tasks, t[0])
+			}
+		}
+
+		for _, t := range a.tasks {
+			if t.version == d.version && d.behavior.Unhealthy {
+				t.state = "TASK_RUNNING"
+			}
+		}
+	}
+
+	s.exit(now)
+}
+
+// crashDelay is how long crashed apps are delayed in the launch queue
+const crashDelay = time.Hour
+
+// crash fails the tasks of the version, recording the last failure
+func (s *Server) crash(id string, a *app, version string, now time.Time) {
+	var tasks []*task
+
+	for _, t := range a.tasks {
+		if t.version != version {
+			tasks = append(tasks, t)
+			continue
+		}
+
+		a.lastTaskFailure = failure(id, t, "TASK_FAILED", now)
+		a.delay = now.Add(crashDelay)
+	}
+
+	a.tasks = tasks
+}
+
+// exit ends the running tasks of the apps with an Exit behavior, recording
+// the failures
+func (s *Server) exit(now time.Time) {
+	deploying := map[string]bool{}
+
+	for _, d := range s.deployments {
+		deploying[d.app] = true
+	}
+
+	for id, a := range s.apps {
+		b := s.behaviors[id]
+
+		if b.Exit == "" || deploying[id] {
+			continue
+		}
+
+		var tasks []*task
+
+		for _, t := range a.tasks {
+			if t.state != "TASK_RUNNING" || now.Sub(t.staged) < b.Duration {
+				tasks = append(tasks, t)
+				continue
+			}
+
+			if b.Exit != "TASK_FINISHED" {
+				a.lastTaskFailure = failure(id, t, b.Exit, now)
+			}
+		}
+
+		a.tasks = tasks
+	}
+}
+
+func failure(id string, t *task, state string, now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"appId":     id,
+		"host":      "agent.mesos",
+		"message":   "Command exited with status 1",
+		"state":     state,
+		"taskId":    t.id,
+		"timestamp": now.UTC().Format(versionFormat),
+		"version":   t.version,
+	}
+}
+
+// launch creates the tasks of a definition, either all running and healthy
+// or a single staging task
+func (s *Server) launch(id string, def map[string]interface{}, running bool) []*task {
+	instances := 1
+
+	if n, ok := def["instances"].(float64); ok {
+		instances = int(n)
+	}
+
+	if !running && instances > 0 {
+		instances = 1
+	}
+
+	var tasks []*task
+
+	for i := 0; i < instances; i++ {
+		s.ids++
+
+		t := &task{
+			id:      fmt.Sprintf("%s.%08x", strings.Replace(strings.TrimPrefix(id, "/"), "/", "_", -1), s.ids),
+			version: fmt.Sprint(def["version"]),
+			state:   "TASK_STAGING",
+			staged:  time.Now(),
+		}
+
+		if running {
+			t.state = "TASK_RUNNING"
+			t.healthy = true
+		}
+
+		tasks = append(tasks, t)
+	}
+
+	return tasks
+}
+
+func (s *Server) tasks(id string, a *app) []map[string]interface{} {
+	hasHealthChecks := false
+
+	if checks, ok := a.definition["healthChecks"].([]interface{}); ok {
+		hasHealthChecks = len(checks) > 0
+	}
+
+	tasks := []map[string]interface{}{}
+
+	for _, t := range a.tasks {
+		task := map[string]interface{}{
+			"id":       t.id,
+			"appId":    id,
+			"host":     "agent.mesos",
+			"state":    t.state,
+			"version":  t.version,
+			"stagedAt": t.staged.UTC().Format(versionFormat),
+		}
+
+		if t.state == "TASK_RUNNING" {
+			task["startedAt"] = t.staged.UTC().Format(versionFormat)
+		}
+
+		if hasHealthChecks && t.state == "TASK_RUNNING" {
+			task["healthCheckResults"] = []map[string]interface{}{
+				{"alive": t.healthy, "taskId": t.id},
+			}
+		}
+
+		tasks = append(tasks, task)
+	}
+
+	return tasks
+}
+
+// status returns the app definition with its task counts and deployments
+func (s *Server) status(id string, a *app) map[string]interface{} {
+	status := copyDefinition(a.definition)
+	tasks := s.tasks(id, a)
+
+	running, staged, healthy, unhealthy := 0, 0, 0, 0
+
+	for _, t := range a.tasks {
+		if t.state == "TASK_STAGING" {
+			staged++
+			continue
+		}
+
+		running++
+
+		if t.healthy {
+			healthy++
+		} else {
+			unhealthy++
+		}
+	}
+
+	deployments := []map[string]string{}
+
+	for _, d := range s.deployments {
+		if d.app == id {
+			deployments = append(deployments, map[string]string{"id": d.id})
+		}
+	}
+
+	status["tasks"] = tasks
+	status["tasksRunning"] = running
+	status["tasksStaged"] = staged
+	status["tasksHealthy"] = healthy
+	status["tasksUnhealthy"] = unhealthy
+	status["deployments"] = deployments
+
+	if a.lastTaskFailure != nil {
+		status["lastTaskFailure"] = a.lastTaskFailure
+	}
+
+	return status
+}
+
+// queue lists the delayed apps
+func (s *Server) queue(w http.ResponseWriter) {
+	items := []map[string]interface{}{}
+	now := time.Now()
+
+	for _, id := range s.appIDs() {
+		a := s.apps[id]
+
+		if !now.Before(a.delay) {
+			continue
+		}
+
+		items = append(items, map[string]interface{}{
+			"count": 1,
+			"delay": map[string]interface{}{
+				"overdue":         false,
+				"timeLeftSeconds": int(a.delay.Sub(now) / time.Second),
+			},
+			"app": copyDefinition(a.definition),
+		})
+	}
+
+	reply(w, http.StatusOK, map[string]interface{}{"queue": items})
+}
+
+func (s *Server) resetDelay(w http.ResponseWriter, id string) {
+	a, ok := s.apps[id]
+
+	if !ok || !time.Now().Before(a.delay) {
+		notFound(w, "Application %s not found in tasks queue.", id)
+		return
+	}
+
+	a.delay = time.Time{}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// servePods lists and creates pods, pods are not deployed
+func (s *Server) servePods(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodHead:
+		w.WriteHeader(http.StatusOK)
+
+	case http.MethodGet:
+		var ids []string
+
+		for id := range s.pods {
+			ids = append(ids, id)
+		}
+
+		sort.Strings(ids)
+		pods := []map[string]interface{}{}
+
+		for _, id := range ids {
+			pods = append(pods, copyDefinition(s.pods[id]))
+		}
+
+		reply(w, http.StatusOK, pods)
+
+	case http.MethodPost:
+		var def map[string]interface{}
+
+		if !decode(w, r, &def) {
+			return
+		}
+
+		if _, ok := s.pods[normalizeID(fmt.Sprint(def["id"]))]; ok {
+			reply(w, http.StatusConflict, map[string]string{"message": "Pod already exists"})
+			return
+		}
+
+		reply(w, http.StatusCreated, s.addPod(def))
+
+	default:
+		reply(w, http.StatusMethodNotAllowed, map[string]string{"message": "method not allowed"})
+	}
+}
+
+func (s *Server) addPod(def map[string]interface{}) map[string]interface{} {
+	id := normalizeID(fmt.Sprint(def["id"]))
+	def["id"] = id
+	def["version"] = s.nextVersion()
+	s.pods[id] = def
+	s.addGroups(id)
+
+	return copyDefinition(def)
+}
+
+func (s *Server) listApps(w http.ResponseWriter, filter string) {
+	apps := []map[string]interface{}{}
+
+	for _, id := range s.appIDs() {
+		if strings.Contains(id, filter) {
+			apps = append(apps, s.status(id, s.apps[id]))
+		}
+	}
+
+	reply(w, http.StatusOK, map[string]interface{}{"apps": apps})
+}
+
+func (s *Server) listDeployments(w http.ResponseWriter) {
+	deployments := []map[string]interface{}{}
+
+	var ids []string
+
+	for id := range s.deployments {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		d := s.deployments[id]
+		action := map[string]interface{}{"action": d.action, "app": d.app}
+
+		deployments = append(deployments, map[string]interface{}{
+			"id":             d.id,
+			"version":        d.version,
+			"affectedApps":   []string{d.app},
+			"affectedPods":   []string{},
+			"steps":          []interface{}{map[string]interface{}{"actions": []interface{}{action}}},
+			"currentActions": []interface{}{action},
+			"currentStep":    1,
+			"totalSteps":     1,
+		})
+	}
+
+	reply(w, http.StatusOK, deployments)
+}
+
+// serveGroup returns the group tree, or deletes the group with its apps
+func (s *Server) serveGroup(w http.ResponseWriter, r *http.Request, id string) {
+	if id == "/" {
+		id = ""
+	}
+
+	if id != "" && !s.groups[id] {
+		notFound(w, "Group '%s' does not exist", id)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		reply(w, http.StatusOK, s.group(id))
+
+	case http.MethodDelete:
+		s.ids++
+
+		d := &deployment{
+			id:      fmt.Sprintf("%08x-0000-4000-8000-000000000000", s.ids),
+			version: s.nextVersion(),
+			app:     id,
+			action:  "StopApplication",
+			started: time.Now(),
+			group:   true,
+		}
+
+		s.deployments[d.id] = d
+		s.advance()
+
+		reply(w, http.StatusOK, map[string]string{"deploymentId": d.id, "version": d.version})
+
+	default:
+		reply(w, http.StatusMethodNotAllowed, map[string]string{"message": "method not allowed"})
+	}
+}
+
+func (s *Server) group(id string) map[string]interface{} {
+	apps := []interface{}{}
+	groups := []interface{}{}
+
+	for _, appID := range s.appIDs() {
+		if parent(appID) == id {
+			apps = append(apps, copyDefinition(s.apps[appID].definition))
+		}
+	}
+
+	for _, groupID := range s.groupIDs() {
+		if parent(groupID) == id {
+			groups = append(groups, s.group(groupID))
+		}
+	}
+
+	if id == "" {
+		id = "/"
+	}
+
+	return map[string]interface{}{
+		"id":           id,
+		"apps":         apps,
+		"groups":       groups,
+		"dependencies": []string{},
+	}
+}
+
+// addGroups creates the groups holding the app, as Marathon does
+func (s *Server) addGroups(id string) {
+	for g := parent(id); g != ""; g = parent(g) {
+		s.groups[g] = true
+	}
+}
+
+// remove deletes the app, or the group with its apps and subgroups
+func (s *Server) remove(id string, group bool) {
+	if !group {
+		delete(s.apps, id)
+		return
+	}
+
+	delete(s.groups, id)
+
+	for appID := range s.apps {
+		if strings.HasPrefix(appID, id+"/") {
+			delete(s.apps, appID)
+		}
+	}
+
+	for groupID := range s.groups {
+		if strings.HasPrefix(groupID, id+"/") {
+			delete(s.groups, groupID)
+		}
+	}
+}
+
+func (s *Server) groupIDs() []string {
+	var ids []string
+
+	for id := range s.groups {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+	return ids
+}
+
+// parent returns the group holding id, empty for the root group
+func parent(id string) string {
+	if i := strings.LastIndex(id, "/"); i > 0 {
+		return id[:i]
+	}
+	return ""
+}
+
+func (s *Server) appIDs() []string {
+	var ids []string
+
+	for id := range s.apps {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+	return ids
+}
+
+const versionFormat = "2006-01-02T15:04:05.000Z"
+
+// nextVersion returns a new, always increasing, version timestamp
+func (s *Server) nextVersion() string {
+	s.clock = s.clock.Add(time.Second)
+	return s.clock.Format(versionFormat)
+}
+
+func (a *app) version(version string) map[string]interface{} {
+	for _, def := range a.versions {
+		if def["version"] == version {
+			return def
+		}
+	}
+	return nil
+}
+
+// previous returns the version deployed before version
+func (a *app) previous(version string) map[string]interface{} {
+	for i, def := range a.versions {
+		if def["version"] == version && i > 0 {
+			return a.versions[i-1]
+		}
+	}
+	return nil
+}
+
+func copyDefinition(def map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(def))
+
+	for k, v := range def {
+		c[k] = v
+	}
+
+	return c
+}
+
+func normalizeID(id string) string {
+	return "/" + strings.Trim(id, "/")
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	b, err := ioutil.ReadAll(r.Body)
+
+	if err == nil {
+		err = json.Unmarshal(b, v)
+	}
+
+	if err != nil {
+		reply(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return false
+	}
+
+	return true
+}
+
+func notFound(w http.ResponseWriter, format string, args ...interface{}) {
+	reply(w, http.StatusNotFound, map[string]string{"message": fmt.Sprintf(format, args...)})
+}
+
+func reply(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,167 @@
+// Package metronome is a client for the Metronome v1 API, which runs DC/OS
+// jobs, with the job upsert and run helpers used by the drone-marathon plugin.
+package metronome
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// APIError is returned for Metronome API error responses
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("metronome: %d %s", e.Status, e.Message)
+}
+
+// IsNotFound reports whether err is a Metronome 404 response
+func IsNotFound(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.Status == http.StatusNotFound
+}
+
+// Client calls the Metronome v1 API
+type Client struct {
+	// URL is the Metronome server, e.g. http://leader.mesos/service/metronome
+	URL string
+	// Token, if set, is sent as a DC/OS authentication token
+	Token string
+	HTTP  *http.Client
+}
+
+// NewClient creates a Metronome client
+func NewClient(url, token string) *Client {
+	return &Client{
+		URL:   strings.TrimSuffix(url, "/"),
+		Token: token,
+		HTTP:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Job returns the job, with its schedules
+func (m *Client) Job(id string) (*Job, error) {
+	job := new(Job)
+	return job, m.do(http.MethodGet, "/v1/jobs/"+id+"?embed=schedules", nil, job)
+}
+
+// CreateJob creates the job, without its schedules
+func (m *Client) CreateJob(job *Job) error {
+	return m.do(http.MethodPost, "/v1/jobs", job.withoutSchedules(), nil)
+}
+
+// UpdateJob replaces the job definition, without its schedules
+func (m *Client) UpdateJob(job *Job) error {
+	return m.do(http.MethodPut, "/v1/jobs/"+job.ID, job.withoutSchedules(), nil)
+}
+
+// CreateSchedule adds a schedule to the job
+func (m *Client) CreateSchedule(jobID string, schedule Schedule) error {
+	return m.do(http.MethodPost, "/v1/jobs/"+jobID+"/schedules", schedule, nil)
+}
+
+// UpdateSchedule replaces a schedule of the job
+func (m *Client) UpdateSchedule(jobID string, schedule Schedule) error {
+	return m.do(http.MethodPut, "/v1/jobs/"+jobID+"/schedules/"+schedule.ID, schedule, nil)
+}
+
+// DeleteSchedule removes a schedule from the job
+func (m *Client) DeleteSchedule(jobID, scheduleID string) error {
+	return m.do(http.MethodDelete, "/v1/jobs/"+jobID+"/schedules/"+scheduleID, nil, nil)
+}
+
+// StartRun triggers a run of the job
+func (m *Client) StartRun(jobID string) (*Run, error) {
+	run := new(Run)
+	return run, m.do(http.MethodPost, "/v1/jobs/"+jobID+"/runs", struct{}{}, run)
+}
+
+// Run returns an active run of the job, finished runs are not found and
+// show up in the job History instead
+func (m *Client) Run(jobID, runID string) (*Run, error) {
+	run := new(Run)
+	return run, m.do(http.MethodGet, "/v1/jobs/"+jobID+"/runs/"+runID, nil, run)
+}
+
+// History returns the finished runs of the job
+func (m *Client) History(jobID string) (*History, error) {
+	job := new(struct {
+		History History `json:"history"`
+	})
+
+	if err := m.do(http.MethodGet, "/v1/jobs/"+jobID+"?embed=history", nil, job); err != nil {
+		return nil, err
+	}
+
+	return &job.History, nil
+}
+
+func (m *Client) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+
+	if in != nil {
+		b, err := json.Marshal(in)
+
+		if err != nil {
+			return err
+		}
+
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, m.URL+path, body)
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if m.Token != "" {
+		req.Header.Set("Authorization", "token="+m.Token)
+	}
+
+	resp, err := m.HTTP.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 300 {
+		var message struct {
+			Message string `json:"message"`
+		}
+
+		if json.Unmarshal(b, &message) != nil || message.Message == "" {
+			message.Message = strings.TrimSpace(string(b))
+		}
+
+		return &APIError{Status: resp.StatusCode, Message: message.Message}
+	}
+
+	if out == nil || len(b) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(b, out)
+}
@@ -0,0 +1,228 @@
+package metronome
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ghodss/yaml"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Run statuses
+const (
+	StatusSuccess = "SUCCESS"
+	StatusFailed  = "FAILED"
+)
+
+// runPollInterval is how often a run is checked while waiting on it
+var runPollInterval = 2 * time.Second
+
+// Job is a Metronome job definition, the run specification is kept as is
+type Job struct {
+	ID          string            `json:"id"`
+	Description string            `json:"description,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Run         json.RawMessage   `json:"run"`
+	Schedules   []Schedule        `json:"schedules,omitempty"`
+}
+
+// Schedule runs a job on a cron schedule
+type Schedule struct {
+	ID                      string `json:"id"`
+	Cron                    string `json:"cron"`
+	TimeZone                string `json:"timezone,omitempty"`
+	StartingDeadlineSeconds int    `json:"startingDeadlineSeconds,omitempty"`
+	ConcurrencyPolicy       string `json:"concurrencyPolicy,omitempty"`
+	Enabled                 *bool  `json:"enabled,omitempty"`
+}
+
+// Run is a run of a job
+type Run struct {
+	ID     string `json:"id"`
+	JobID  string `json:"jobId"`
+	Status string `json:"status"`
+}
+
+// History lists the finished runs of a job
+type History struct {
+	SuccessfulFinishedRuns []Run `json:"successfulFinishedRuns"`
+	FailedFinishedRuns     []Run `json:"failedFinishedRuns"`
+}
+
+// ParseJob parses a YAML or JSON job definition
+func ParseJob(data string) (*Job, error) {
+	job := new(Job)
+
+	if err := yaml.Unmarshal([]byte(data), job); err != nil {
+		return nil, err
+	}
+
+	if job.ID == "" {
+		return nil, errors.New("the job definition has no id")
+	}
+
+	if len(job.Run) == 0 {
+		return nil, errors.New("the job definition has no run specification")
+	}
+
+	return job, nil
+}
+
+func (j *Job) withoutSchedules() *Job {
+	job := *j
+	job.Schedules = nil
+	return &job
+}
+
+// Upsert creates the job or updates it, then replaces its schedules with the
+// ones in the job definition
+func (m *Client) Upsert(job *Job) error {
+	ctx := log.WithField("job", job.ID)
+
+	current, err := m.Job(job.ID)
+
+	switch {
+	case IsNotFound(err):
+		ctx.Info("creating job")
+		current = &Job{}
+		err = m.CreateJob(job)
+	case err == nil:
+		ctx.Info("updating job")
+		err = m.UpdateJob(job)
+	}
+
+	if err != nil {
+		ctx.WithError(err).Error("failed to upsert job")
+		return err
+	}
+
+	return m.replaceSchedules(ctx, job, current.Schedules)
+}
+
+func (m *Client) replaceSchedules(ctx *log.Entry, job *Job, current []Schedule) error {
+	existing := map[string]bool{}
+
+	for _, s := range current {
+		existing[s.ID] = true
+	}
+
+	for _, s := range job.Schedules {
+		ctx := ctx.WithFields(log.Fields{"schedule": s.ID, "cron": s.Cron})
+		var err error
+
+		if existing[s.ID] {
+			ctx.Info("updating schedule")
+			err = m.UpdateSchedule(job.ID, s)
+		} else {
+			ctx.Info("creating schedule")
+			err = m.CreateSchedule(job.ID, s)
+		}
+
+		if err != nil {
+			ctx.WithError(err).Error("failed to replace schedule")
+			return err
+		}
+
+		delete(existing, s.ID)
+	}
+
+	for id := range existing {
+		ctx.WithField("schedule", id).Info("deleting schedule")
+
+		if err := m.DeleteSchedule(job.ID, id); err != nil {
+			ctx.WithError(err).WithField("schedule", id).Error("failed to delete schedule")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RunAndWait triggers a run of the job and waits for it to finish, failing
+// when the run fails, c is done or the timeout expires
+func (m *Client) RunAndWait(c context.Context, jobID string, timeout time.Duration) error {
+	ctx := log.WithField("job", jobID)
+
+	run, err := m.StartRun(jobID)
+
+	if err != nil {
+		ctx.WithError(err).Error("failed to start job run")
+		return err
+	}
+
+	ctx = ctx.WithField("run", run.ID)
+	ctx.Info("waiting for job run to finish")
+
+	start := time.Now()
+	tick := time.NewTicker(runPollInterval)
+	defer tick.Stop()
+	tout := time.After(timeout)
+
+	for {
+		status, err := m.runStatus(jobID, run.ID)
+
+		if err != nil {
+			ctx.WithError(err).Error("failed to get job run status")
+			return err
+		}
+
+		switch status {
+		case StatusSuccess:
+			ctx.WithField("duration_ms", int64(time.Since(start)/time.Millisecond)).Info("job run succeeded")
+			return nil
+		case StatusFailed:
+			err := fmt.Errorf("job run %s of %s failed", run.ID, jobID)
+			ctx.Error(err)
+			return err
+		}
+
+		select {
+		case <-tick.C:
+		case <-tout:
+			err := fmt.Errorf("job run %s of %s did not finish within %v", run.ID, jobID, timeout)
+			ctx.Error(err)
+			return err
+		case <-c.Done():
+			ctx.Warning("stopped waiting for job run, it is left running")
+			return c.Err()
+		}
+	}
+}
+
+// runStatus returns the run status, looking it up in the job history once
+// the run is finished
+func (m *Client) runStatus(jobID, runID string) (string, error) {
+	run, err := m.Run(jobID, runID)
+
+	if err == nil {
+		return run.Status, nil
+	}
+
+	if !IsNotFound(err) {
+		return "", err
+	}
+
+	history, err := m.History(jobID)
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, r := range history.SuccessfulFinishedRuns {
+		if r.ID == runID {
+			return StatusSuccess, nil
+		}
+	}
+
+	for _, r := range history.FailedFinishedRuns {
+		if r.ID == runID {
+			return StatusFailed, nil
+		}
+	}
+
+	return "", fmt.Errorf("job run %s of %s not found", runID, jobID)
+}
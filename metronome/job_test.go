@@ -0,0 +1,251 @@
+package metronome
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func init() {
+	runPollInterval = 10 * time.Millisecond
+}
+
+var job = `
+id: reports.daily
+description: daily reports
+labels:
+  outcome: SUCCESS
+run:
+  cpus: 0.1
+  mem: 64
+  docker:
+    image: quintoandar/reports
+schedules:
+  - id: daily
+    cron: "0 3 * * *"
+  - id: weekly
+    cron: "0 5 * * 1"
+`
+
+// stub is an in-memory Metronome, runs are active on the first check and
+// then finish with the outcome label of the job
+type stub struct {
+	mu        sync.Mutex
+	token     string
+	jobs      map[string]*Job
+	schedules map[string]map[string]Schedule
+	runs      map[string]int
+	history   map[string]*History
+	requests  []string
+}
+
+func newStub() (*stub, *httptest.Server) {
+	s := &stub{
+		jobs:      map[string]*Job{},
+		schedules: map[string]map[string]Schedule{},
+		runs:      map[string]int{},
+		history:   map[string]*History{},
+	}
+	return s, httptest.NewServer(s)
+}
+
+func (s *stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.token = r.Header.Get("Authorization")
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/jobs"), "/")
+	id := ""
+
+	if len(parts) > 1 {
+		id = parts[1]
+	}
+
+	reply := func(status int, body interface{}) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
+
+	notFound := func() {
+		reply(http.StatusNotFound, map[string]string{"message": "not found"})
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodPost:
+		j := new(Job)
+		json.NewDecoder(r.Body).Decode(j)
+		s.jobs[j.ID] = j
+		s.schedules[j.ID] = map[string]Schedule{}
+		s.history[j.ID] = &History{}
+		reply(http.StatusCreated, j)
+
+	case s.jobs[id] == nil:
+		notFound()
+
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		j := *s.jobs[id]
+		for _, schedule := range s.schedules[id] {
+			j.Schedules = append(j.Schedules, schedule)
+		}
+		reply(http.StatusOK, map[string]interface{}{
+			"id":        j.ID,
+			"run":       j.Run,
+			"schedules": j.Schedules,
+			"history":   s.history[id],
+		})
+
+	case len(parts) == 2 && r.Method == http.MethodPut:
+		j := new(Job)
+		json.NewDecoder(r.Body).Decode(j)
+		s.jobs[id] = j
+		reply(http.StatusOK, j)
+
+	case len(parts) >= 3 && parts[2] == "schedules":
+		schedule := Schedule{}
+		json.NewDecoder(r.Body).Decode(&schedule)
+
+		switch r.Method {
+		case http.MethodPost, http.MethodPut:
+			s.schedules[id][schedule.ID] = schedule
+			reply(http.StatusOK, schedule)
+		case http.MethodDelete:
+			delete(s.schedules[id], parts[3])
+			w.WriteHeader(http.StatusOK)
+		}
+
+	case len(parts) == 3 && parts[2] == "runs" && r.Method == http.MethodPost:
+		run := Run{ID: fmt.Sprintf("run-%d", len(s.requests)), JobID: id, Status: "INITIAL"}
+		s.runs[run.ID] = 0
+		reply(http.StatusCreated, run)
+
+	case len(parts) == 4 && parts[2] == "runs" && r.Method == http.MethodGet:
+		checks, ok := s.runs[parts[3]]
+
+		if !ok {
+			notFound()
+			return
+		}
+
+		if checks == 0 {
+			s.runs[parts[3]]++
+			reply(http.StatusOK, Run{ID: parts[3], JobID: id, Status: "ACTIVE"})
+			return
+		}
+
+		delete(s.runs, parts[3])
+		run := Run{ID: parts[3], JobID: id}
+
+		if s.jobs[id].Labels["outcome"] == StatusFailed {
+			s.history[id].FailedFinishedRuns = append(s.history[id].FailedFinishedRuns, run)
+		} else {
+			s.history[id].SuccessfulFinishedRuns = append(s.history[id].SuccessfulFinishedRuns, run)
+		}
+
+		notFound()
+
+	default:
+		notFound()
+	}
+}
+
+func parseJob(t *testing.T, data string) *Job {
+	j, err := ParseJob(data)
+
+	if err != nil {
+		t.Fatalf("ParseJob failed: \n%v", err)
+	}
+
+	return j
+}
+
+func (s *stub) scheduleIDs(id string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []string
+
+	for sid := range s.schedules[id] {
+		ids = append(ids, sid)
+	}
+
+	sort.Strings(ids)
+	return ids
+}
+
+func TestUpsertJob(t *testing.T) {
+	stub, server := newStub()
+	defer server.Close()
+
+	client := NewClient(server.URL, "secret")
+
+	if err := client.Upsert(parseJob(t, job)); err != nil {
+		t.Fatalf("Upsert failed: \n%v", err)
+	}
+
+	if ids := stub.scheduleIDs("reports.daily"); !reflect.DeepEqual(ids, []string{"daily", "weekly"}) {
+		t.Fatalf("schedules were not created: %v", ids)
+	}
+
+	updated := parseJob(t, job)
+	updated.Description = "updated"
+	updated.Schedules = []Schedule{{ID: "hourly", Cron: "0 * * * *"}}
+
+	if err := client.Upsert(updated); err != nil {
+		t.Fatalf("Upsert failed: \n%v", err)
+	}
+
+	if stub.jobs["reports.daily"].Description != "updated" {
+		t.Fatalf("job was not updated")
+	}
+
+	if ids := stub.scheduleIDs("reports.daily"); !reflect.DeepEqual(ids, []string{"hourly"}) {
+		t.Fatalf("schedules were not replaced: %v", ids)
+	}
+
+	if stub.token != "token=secret" {
+		t.Fatalf("unexpected authorization: %q", stub.token)
+	}
+}
+
+func TestRunAndWait(t *testing.T) {
+	_, server := newStub()
+	defer server.Close()
+
+	client := NewClient(server.URL, "")
+
+	if err := client.Upsert(parseJob(t, job)); err != nil {
+		t.Fatalf("Upsert failed: \n%v", err)
+	}
+
+	if err := client.RunAndWait(context.Background(), "reports.daily", time.Minute); err != nil {
+		t.Fatalf("RunAndWait failed: \n%v", err)
+	}
+
+	failing := parseJob(t, strings.Replace(job, "SUCCESS", "FAILED", 1))
+
+	if err := client.Upsert(failing); err != nil {
+		t.Fatalf("Upsert failed: \n%v", err)
+	}
+
+	if err := client.RunAndWait(context.Background(), "reports.daily", time.Minute); err == nil {
+		t.Fatalf("RunAndWait did not fail")
+	}
+}
+
+func TestParseJobInvalid(t *testing.T) {
+	for _, data := range []string{"run: {cpus: 1}", "id: job", "id: ["} {
+		if _, err := ParseJob(data); err == nil {
+			t.Fatalf("ParseJob accepted %q", data)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/quintoandar/drone-marathon/deploy"
+
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+const webhook = "http://hooks.example.com"
+
+func TestNotifyDeployLifecycle(t *testing.T) {
+	defer gock.Off()
+
+	gock.New(server).Get("/v2/deployments").Reply(200).JSON([]map[string]string{})
+	gock.New(server).Put("/v2/apps/quintoandar/app").Reply(201).
+		JSON(map[string]string{
+			"deploymentId": "5ed4c0c5-9ff8-4a6f-a0cd-f57f59a34b43",
+			"version":      "2015-09-29T15:59:51.164Z",
+		})
+
+	gock.New(webhook).Post("/hook").
+		BodyString(`"event":"deploy_started","app":"quintoandar/app","deployment":"5ed4c0c5-9ff8-4a6f-a0cd-f57f59a34b43"`).
+		Reply(200)
+	gock.New(webhook).Post("/hook").
+		BodyString(`"event":"deploy_succeeded"`).
+		Reply(200)
+
+	plugin := Plugin{
+		Server:        server,
+		AppConfig:     app,
+		Webhooks:      []string{webhook + "/hook"},
+		WebhookFormat: deploy.FormatJSON,
+		Debug:         true,
+		Timeout:       time.Duration(5) * time.Minute,
+	}
+
+	if err := plugin.Exec(); err != nil {
+		t.Fatalf("plugin.Exec failed: \n%v", err)
+	}
+
+	if !gock.IsDone() {
+		t.Fatalf("gock.IsDone() false")
+	}
+}
+
+func TestNotifyFailedWebhookDoesNotFailDeploy(t *testing.T) {
+	defer gock.Off()
+
+	gock.New(server).Get("/v2/deployments").Reply(200).JSON([]map[string]string{})
+	gock.New(server).Put("/v2/apps/quintoandar/app").Reply(201).
+		JSON(map[string]string{
+			"deploymentId": "5ed4c0c5-9ff8-4a6f-a0cd-f57f59a34b43",
+			"version":      "2015-09-29T15:59:51.164Z",
+		})
+
+	gock.New(webhook).Post("/slack").Times(2).
+		BodyString(`"attachments"`).
+		Reply(500)
+
+	plugin := Plugin{
+		Server:        server,
+		AppConfig:     app,
+		Webhooks:      []string{webhook + "/slack"},
+		WebhookFormat: deploy.FormatSlack,
+		Debug:         true,
+		Timeout:       time.Duration(5) * time.Minute,
+	}
+
+	if err := plugin.Exec(); err != nil {
+		t.Fatalf("plugin.Exec failed: \n%v", err)
+	}
+
+	if !gock.IsDone() {
+		t.Fatalf("gock.IsDone() false")
+	}
+}
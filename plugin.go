@@ -1,360 +1,683 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/drone/envsubst"
-	"github.com/ghodss/yaml"
+	"github.com/quintoandar/drone-marathon/deploy"
+	"github.com/quintoandar/drone-marathon/metronome"
 
 	marathon "github.com/fbcbarbosa/go-marathon"
 
 	log "github.com/Sirupsen/logrus"
 )
 
+// Plugin modes
+const (
+	modeDeploy  = "deploy"
+	modeScale   = "scale"
+	modeRestart = "restart"
+	modeDestroy = "destroy"
+	modeJob     = "job"
+	modeGC      = "gc"
+)
+
 // Plugin defines the parameters
 type Plugin struct {
-	Server       string
-	Marathonfile string
-	AppConfig    string
-	Timeout      time.Duration
-	Rollback     bool
-	Debug        bool
+	Server             string
+	Metronome          string
+	Token              string
+	Mode               string
+	AppID              string
+	Instances          string
+	JobRun             bool
+	DestroyPrefix      string
+	PruneGroups        bool
+	TTL                time.Duration
+	DryRun             bool
+	MaxDeletions       int
+	Marathonfile       string
+	AppConfig          string
+	Overlays           []string
+	OverlayMerge       string
+	Template           bool
+	Policy             string
+	PolicyMode         string
+	Report             string
+	Webhooks           []string
+	WebhookFormat      string
+	Timeout            time.Duration
+	DrainTimeout       time.Duration
+	RollbackTimeout    time.Duration
+	Deadline           time.Duration
+	PreDeploy          string
+	PreDeployTimeout   time.Duration
+	ProgressInterval   time.Duration
+	ObserveWindow      time.Duration
+	ObserveMinHealthy  int
+	CrashLoopThreshold int
+	CrashLoopWindow    time.Duration
+	Rollback           bool
+	ResetDelay         bool
+	OnCancel           string
+	CancelGrace        time.Duration
+	Networking         string
+	RetryTimeout       time.Duration
+	Debug              bool
 }
 
 // Exec runs the plugin
 func (p *Plugin) Exec() error {
+	return p.ExecContext(context.Background())
+}
+
+// ExecContext runs the plugin, cancelling c interrupts the deploy and applies
+// the OnCancel action to the in-flight deployment
+func (p *Plugin) ExecContext(c context.Context) error {
 
 	log.WithFields(log.Fields{
 		"server":       p.Server,
+		"mode":         p.Mode,
 		"marathonfile": p.Marathonfile,
+		"overlays":     p.Overlays,
+		"template":     p.Template,
+		"policy":       p.Policy,
+		"report":       p.Report,
+		"webhooks":     len(p.Webhooks),
 		"timeout":      p.Timeout,
+		"deadline":     p.Deadline,
 		"rollback":     p.Rollback,
+		"on_cancel":    p.OnCancel,
+		"retry":        p.RetryTimeout,
 		"debug":        p.Debug,
 	}).Info("attempting to start job")
 
-	data, err := p.ReadInput()
+	webhooks := deploy.Webhooks{URLs: p.Webhooks, Format: p.WebhookFormat}
+	result, err := p.deploy(c, webhooks)
+
+	// the deploy did not start, report why
+	if result == nil {
+		result = deploy.NewResult()
+		result.Finish(err)
+		webhooks.Notify(result.Event(), result, err)
+	}
+
+	if p.Report == "" {
+		return err
+	}
+
+	if werr := result.WriteFile(p.Report); werr != nil {
+		log.WithFields(log.Fields{
+			"err":  werr,
+			"file": p.Report,
+		}).Error("failed to write deploy report")
+	}
+
+	return err
+}
+
+func (p *Plugin) deploy(c context.Context, webhooks deploy.Webhooks) (*deploy.Result, error) {
+	switch p.Mode {
+	case modeDeploy, "":
+	case modeScale, modeRestart, modeDestroy:
+		return p.operate(c, webhooks)
+	case modeJob:
+		return p.job(c, webhooks)
+	case modeGC:
+		return p.gc(c, webhooks)
+	default:
+		err := fmt.Errorf("unknown mode %q", p.Mode)
+		log.WithError(err).Error("invalid mode configuration")
+		return nil, err
+	}
+
+	data, err := p.input().Read()
 
 	if err != nil {
 		log.WithFields(log.Fields{
 			"err": err,
 		}).Error("failed to read marathonfile/app_config input data")
-		return err
+		return nil, err
 	}
 
-	b, err := parseData(data)
+	app, err := deploy.Parse(data)
 
 	if err != nil {
-		log.WithFields(log.Fields{
-			"err": err,
-		}).Errorf("failed to parse input data into JSON format")
-		return err
+		return nil, err
 	}
 
-	log.Info("searching Marathon clusters")
+	// report broken definitions before contacting Marathon
+	if err := deploy.Validate(app); err != nil {
+		log.WithField("app", app.ID).Error(err)
+		return nil, err
+	}
 
-	config := marathon.NewDefaultConfig()
-	config.URL = p.Server
+	opts := p.options(webhooks)
 
-	if p.Debug == true {
-		config.LogOutput = os.Stdout
+	if opts.Policy, err = p.policy(); err != nil {
+		return nil, err
 	}
 
-	client, err := marathon.NewClient(config)
+	client, err := p.client(c)
 
 	if err != nil {
-		log.WithFields(log.Fields{
-			"err": err,
-		}).Error("failed to create a client for marathon")
-		return err
+		return nil, err
 	}
 
-	var app marathon.Application
+	return deploy.New(client, opts).Deploy(c, app)
+}
 
-	if err := app.UnmarshalJSON(b); err != nil {
-		log.WithFields(log.Fields{
-			"err": err,
-		}).Error("failed to unmarshal marathonfile: ", string(b))
-		return err
+// operate scales, restarts or destroys the application without changing its
+// configuration
+func (p *Plugin) operate(c context.Context, webhooks deploy.Webhooks) (*deploy.Result, error) {
+	appID, err := p.appID()
+
+	if err != nil {
+		return nil, err
 	}
 
-	ctx := log.WithField("app", app.ID)
-	ctx.Info("applying configuration defaults")
+	var scale deploy.Scale
+	opts := p.options(webhooks)
 
-	// Set every uri extract to true by default
-	if app.Fetch != nil {
-		var fetch []marathon.Fetch
-		for _, v := range *app.Fetch {
-			v.Extract = true
-			fetch = append(fetch, v)
+	if p.Mode == modeScale {
+		if scale, err = deploy.ParseScale(p.Instances); err != nil {
+			log.WithError(err).Error("invalid instances configuration")
+			return nil, err
 		}
-		app.Fetch = &fetch
-	}
 
-	// Set faster default healthcheck timing configuration to avoid long rollbacks
-	if app.HealthChecks != nil {
-		for _, h := range *app.HealthChecks {
-			if h.GracePeriodSeconds == 0 {
-				h.GracePeriodSeconds = 60
-			}
-			if h.IntervalSeconds == 0 {
-				h.IntervalSeconds = 15
-			}
-			if h.TimeoutSeconds == 0 {
-				h.TimeoutSeconds = 10
-			}
+		if opts.Policy, err = p.policy(); err != nil {
+			return nil, err
 		}
 	}
 
-	app.Container.Docker.AddParameter("log-driver", "json-file")
-	app.Container.Docker.AddParameter("log-opt", "max-size=512m")
+	client, err := p.client(c)
 
-	var prevVersion *marathon.ApplicationVersion
+	if err != nil {
+		return nil, err
+	}
 
-	// load application in case we need to roll back
-	if p.Rollback {
-		stableApp, err := client.Application(app.ID)
+	deployer := deploy.New(client, opts)
 
-		if err != nil {
-			ctx.WithError(err).Warning("could not get application information" +
-				" from marathon (only required in case of rollback)")
-		} else {
-			prevVersion = &marathon.ApplicationVersion{
-				Version: stableApp.Version,
-			}
-		}
+	switch p.Mode {
+	case modeRestart:
+		return deployer.Restart(c, appID)
+	case modeDestroy:
+		return deployer.Destroy(c, appID)
 	}
 
-	ctx.Info("updating application")
+	return deployer.Scale(c, appID, scale)
+}
 
-	dep, err := client.UpdateApplication(&app, true)
+// policy loads the deploy policy, there is none when it is not configured
+func (p *Plugin) policy() (*deploy.Policy, error) {
+	if p.Policy == "" {
+		return nil, nil
+	}
+
+	policy, err := deploy.LoadPolicy(p.Policy)
 
 	if err != nil {
-		ctx.WithError(err).Error("failed to start application update")
-		return err
+		log.WithFields(log.Fields{
+			"err":    err,
+			"policy": p.Policy,
+		}).Error("failed to load deploy policy")
+		return nil, err
 	}
 
-	ctx.WithFields(log.Fields{
-		"deployment": dep.DeploymentID,
-		"timeout":    p.Timeout,
-		"version":    dep.Version,
-	}).Info("deploying application")
+	return policy, nil
+}
 
-	if err := client.WaitOnDeployment(dep.DeploymentID, p.Timeout); err != nil {
+// job upserts the Metronome job in the marathonfile and optionally runs it
+func (p *Plugin) job(c context.Context, webhooks deploy.Webhooks) (*deploy.Result, error) {
+	data, err := p.input().Read()
 
-		ctx.WithFields(log.Fields{
-			"err":        err,
-			"deployment": dep.DeploymentID,
-			"timeout":    p.Timeout,
-			"version":    dep.Version,
-		}).Error("failed to deploy application")
+	if err != nil {
+		log.WithError(err).Error("failed to read marathonfile/app_config input data")
+		return nil, err
+	}
 
-		if p.Rollback {
+	job, err := metronome.ParseJob(data)
 
-			ctx.WithFields(log.Fields{
-				"deployment": dep.DeploymentID,
-				"version":    dep.Version,
-			}).Info("cancelling deployment")
+	if err != nil {
+		return nil, err
+	}
 
-			if _, err := client.DeleteDeployment(dep.DeploymentID, true); err != nil {
-				ctx.WithError(err).Error("failed to cancel deployment")
-				return err
-			}
+	result := deploy.NewResult()
+	result.App = job.ID
 
-			if prevVersion == nil {
-				ctx.Error("no previous version available to roll back to")
-			}
+	client := metronome.NewClient(p.Metronome, p.Token)
 
-			ctx.WithFields(log.Fields{
-				"deployment": dep.DeploymentID,
-				"version":    dep.Version,
-			}).Info("waiting for all failed tasks to die")
+	if err = client.Upsert(job); err == nil && p.JobRun {
+		err = client.RunAndWait(c, job.ID, p.Timeout)
+	}
 
-			if err := waitOnTasksToDie(client, app.ID, dep.Version, p.Timeout); err != nil {
-				ctx.WithError(err).Error("failed to rollback")
-				return err
-			}
+	result.Finish(err)
+	webhooks.Notify(result.Event(), result, err)
 
-			ctx.WithFields(log.Fields{
-				"deployment": dep.DeploymentID,
-				"timeout":    p.Timeout,
-				"version":    prevVersion.Version,
-			}).Info("rolling back to previous application version")
+	return result, err
+}
 
-			ctx.WithFields(log.Fields{
-				"deployment": dep.DeploymentID,
-				"timeout":    p.Timeout,
-				"version":    prevVersion.Version,
-			}).Info("a new rolling deployment will start")
+// appID returns the configured app id, or the id in the marathonfile
+func (p *Plugin) appID() (string, error) {
+	if p.AppID != "" {
+		return p.AppID, nil
+	}
 
-			rollback, err := client.SetApplicationVersion(app.ID, prevVersion)
+	data, err := p.input().Read()
 
-			if err != nil {
-				ctx.WithError(err).Error("failed to rollback")
-				return err
-			}
+	if err != nil {
+		log.WithError(err).Error("app_id is not set and the marathonfile could not be read")
+		return "", err
+	}
 
-			if err := client.WaitOnDeployment(rollback.DeploymentID, p.Timeout); err != nil {
-
-				ctx.WithFields(log.Fields{
-					"err":      err,
-					"rollback": rollback.DeploymentID,
-					"timeout":  p.Timeout,
-					"version":  prevVersion.Version,
-				}).Error("failed to deploy rollback")
-
-				ctx.WithFields(log.Fields{
-					"rollback": rollback.DeploymentID,
-					"timeout":  p.Timeout,
-					"version":  prevVersion.Version,
-				}).Info("cancelling rollback")
-
-				if _, err := client.DeleteDeployment(rollback.DeploymentID, true); err != nil {
-					ctx.WithFields(log.Fields{
-						"err":      err,
-						"rollback": rollback.DeploymentID,
-						"version":  prevVersion.Version,
-					}).Error("failed to cancel rollback")
-					return err
-				}
-
-				// override Marathon timeout error with a more descriptive error
-				if strings.Contains(err.Error(), "timed out") {
-					err = errors.New(
-						"your rollback has failed and the application is at an" +
-							" unknown state, please check your application logs",
-					)
-				}
-
-				return err
-			}
+	app, err := deploy.Parse(data)
 
-			ctx.WithFields(log.Fields{
-				"deployment": dep.DeploymentID,
-				"rollback":   rollback.DeploymentID,
-				"version":    prevVersion.Version,
-			}).Info("rollback was successful")
+	if err != nil {
+		return "", err
+	}
 
-		} else {
-			ctx.WithField("deployment", dep.DeploymentID).Warning("rollback is not enabled")
-		}
+	return app.ID, nil
+}
 
-		// override Marathon timeout error with a more descriptive error
-		if strings.Contains(err.Error(), "timed out") {
-			err = errors.New(
-				"could not deploy your application within the maximum timeout," +
-					" please check your application logs",
-			)
-		}
+func (p *Plugin) options(webhooks deploy.Webhooks) deploy.Options {
+	return deploy.Options{
+		Timeout:            p.Timeout,
+		DrainTimeout:       p.DrainTimeout,
+		RollbackTimeout:    p.RollbackTimeout,
+		Deadline:           p.Deadline,
+		PreDeploy:          p.PreDeploy,
+		PreDeployTimeout:   p.PreDeployTimeout,
+		ProgressInterval:   p.ProgressInterval,
+		ObserveWindow:      p.ObserveWindow,
+		ObserveMinHealthy:  p.ObserveMinHealthy,
+		CrashLoopThreshold: p.CrashLoopThreshold,
+		CrashLoopWindow:    p.CrashLoopWindow,
+		Rollback:           p.Rollback,
+		ResetDelay:         p.ResetDelay,
+		OnCancel:           p.OnCancel,
+		CancelGrace:        p.CancelGrace,
+		PolicyMode:         p.PolicyMode,
+		Status:             p.Report != "",
+		DestroyPrefix:      p.DestroyPrefix,
+		PruneGroups:        p.PruneGroups,
+		TTL:                p.TTL,
+		OnEvent:            webhooks.Notify,
+	}
+}
+
+// collectGarbage destroys the applications under the destroy prefix past
+// their TTL
+func (p *Plugin) collectGarbage(c context.Context) error {
+	client, err := p.client(c)
 
+	if err != nil {
 		return err
 	}
 
-	ctx.Info("application deployed successfully")
-	return nil
+	opts := p.options(deploy.Webhooks{})
+	opts.Status = false
+
+	_, err = deploy.New(client, opts).GC(c, deploy.GCOptions{
+		TTL:          p.TTL,
+		DryRun:       p.DryRun,
+		MaxDeletions: p.MaxDeletions,
+	})
+
+	return err
 }
 
-// ReadInput reads Marathonfile/Appconfig data
-func (p Plugin) ReadInput() (data string, err error) {
-	if p.Marathonfile != "" {
-		log.WithFields(log.Fields{
-			"file": p.Marathonfile,
-		}).Info("parsing marathonfile")
+// gc collects the garbage under the destroy prefix as a pipeline step, the
+// webhooks get the outcome of the whole run
+func (p *Plugin) gc(c context.Context, webhooks deploy.Webhooks) (*deploy.Result, error) {
+	result := deploy.NewResult()
+	result.App = p.DestroyPrefix
 
-		// When 0.9 comes out, limit to secrets and other Drone variables
-		b, err := ioutil.ReadFile(p.Marathonfile)
+	err := p.collectGarbage(c)
 
-		if err != nil {
-			return "", err
-		}
+	result.Finish(err)
+	webhooks.Notify(result.Event(), result, err)
+
+	return result, err
+}
 
-		log.Infof("App data: \n%s", string(b))
-		return envsubst.EvalEnv(string(b))
+// backup writes the definitions of the apps and pods of the cluster to dir
+func (p *Plugin) backup(c context.Context, dir string) error {
+	if dir == "" {
+		return errors.New("no backup directory")
 	}
 
-	if p.AppConfig != "" {
-		log.Warn("app_config is deprecated, please use a marathonfile instead")
+	client, networks, err := p.connect(c)
 
-		log.Infof("App data: \n%s", string(p.AppConfig))
-		return envsubst.EvalEnv(p.AppConfig)
+	if err != nil {
+		return err
 	}
 
-	err = errors.New("missing parameters")
-	return
+	_, err = deploy.Backup(client, deploy.BackupOptions{
+		Dir:      dir,
+		Server:   p.Server,
+		Networks: networks,
+	})
+
+	return err
 }
 
-func parseData(data string) (b []byte, err error) {
-	if isYAML(data) {
-		log.Info("data is in YAML format, parsing into JSON")
-		return yaml.YAMLToJSON([]byte(data))
+// restore creates the apps and pods of the backup in dir missing from the
+// cluster, only the ones under prefix when set
+func (p *Plugin) restore(c context.Context, dir, prefix string) error {
+	if dir == "" {
+		return errors.New("no backup directory")
 	}
 
-	if isJSON(data) {
-		log.Info("data is in JSON format, no need to parse")
-		return
+	client, err := p.client(c)
+
+	if err != nil {
+		return err
 	}
 
-	err = errors.New("invalid data format")
-	return
+	opts := p.options(deploy.Webhooks{})
+	opts.Status = false
+
+	_, err = deploy.New(client, opts).Restore(c, deploy.RestoreOptions{
+		Dir:    dir,
+		Prefix: prefix,
+		DryRun: p.DryRun,
+	})
+
+	return err
 }
 
-func isJSON(s string) bool {
-	var j map[string]interface{}
-	return json.Unmarshal([]byte(s), &j) == nil
+func (p *Plugin) input() deploy.Input {
+	return deploy.Input{
+		Marathonfile: p.Marathonfile,
+		AppConfig:    p.AppConfig,
+		Overlays:     p.Overlays,
+		OverlayMerge: p.OverlayMerge,
+		Template:     p.Template,
+	}
 }
 
-func isYAML(s string) bool {
-	var y map[string]interface{}
-	return yaml.Unmarshal([]byte(s), &y) == nil
+// client creates a Marathon client that retries transient failures
+func (p *Plugin) client(c context.Context) (deploy.Client, error) {
+	client, _, err := p.connect(c)
+	return client, err
 }
 
-func waitOnTasksToDie(client marathon.Marathon, name, version string, timeout time.Duration) error {
-	if val, err := areTasksDead(client, name, version); err != nil || val {
-		return err
+// connect creates a Marathon client that retries transient failures until c
+// is cancelled and reports whether it uses the Marathon 1.5 networking format
+func (p *Plugin) connect(c context.Context) (deploy.Client, bool, error) {
+	log.Info("searching Marathon clusters")
+
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+
+	config := marathon.NewDefaultConfig()
+	config.URL = p.Server
+	config.DCOSToken = p.Token
+	config.HTTPClient = httpClient
+
+	if p.Debug == true {
+		config.LogOutput = os.Stdout
 	}
 
-	tick := time.Tick(time.Second * 5)
-	tout := time.After(timeout)
+	client, err := marathon.NewClient(config)
 
-	for {
-		select {
+	if err != nil {
+		log.WithFields(log.Fields{
+			"err": err,
+		}).Error("failed to create a client for marathon")
+		return nil, false, err
+	}
 
-		case <-tick:
+	networks, err := p.networks(client)
 
-			if val, err := areTasksDead(client, name, version); err != nil || val {
-				return err
-			}
+	if err != nil {
+		return nil, false, err
+	}
 
-		case <-tout:
-			return errors.New("timed out")
-		}
+	if networks {
+		httpClient.Transport = deploy.NetworkingTransport(nil)
 	}
+
+	return deploy.WithRetry(c, client, p.RetryTimeout), networks, nil
 }
 
-func areTasksDead(client marathon.Marathon, name, version string) (bool, error) {
+// networks reports whether application definitions are sent to Marathon in
+// the Marathon 1.5 networking format, detecting it from the server version
+// in auto mode
+func (p *Plugin) networks(client marathon.Marathon) (bool, error) {
+	switch p.Networking {
+	case deploy.NetworkingLegacy, "":
+		return false, nil
+	case deploy.NetworkingNetworks:
+		return true, nil
+	case deploy.NetworkingAuto:
+	default:
+		err := fmt.Errorf("unknown networking format %q", p.Networking)
+		log.WithError(err).Error("invalid networking configuration")
+		return false, err
+	}
 
-	tasks, err := client.Tasks(name)
+	info, err := client.Info()
 
+	// the definitions are sent unchanged, as a marathonfile in the legacy
+	// format is valid for every version before 1.5
 	if err != nil {
-		return false, err
+		log.WithError(err).Warn("failed to get the Marathon version, sending definitions unchanged")
+		return false, nil
 	}
 
-	return !containsVersion(tasks.Tasks, version), nil
+	networks := deploy.SupportsNetworks(info.Version)
+
+	log.WithFields(log.Fields{
+		"version":  info.Version,
+		"networks": networks,
+	}).Info("detected Marathon version")
+
+	return networks, nil
 }
 
-func containsVersion(tasks []marathon.Task, version string) bool {
-	for _, t := range tasks {
-		if t.Version == version {
-			log.WithFields(log.Fields{
-				"task":    t.ID,
-				"version": version,
-			}).Info("waiting for failed task to die")
+// isOverlay reports whether file is one of the overlays
+func (p *Plugin) isOverlay(file string) bool {
+	for _, overlay := range p.Overlays {
+		if filepath.Clean(overlay) == filepath.Clean(file) {
 			return true
 		}
 	}
+
 	return false
 }
+
+// migrate converts the files, the marathonfile and its overlays by default,
+// to the Marathon 1.5 networking format in place
+func (p *Plugin) migrate(files []string) error {
+	if len(files) == 0 && p.Marathonfile != "" {
+		files = append([]string{p.Marathonfile}, p.Overlays...)
+	}
+
+	if len(files) == 0 {
+		return errors.New("no files to migrate")
+	}
+
+	for _, file := range files {
+		ctx := log.WithField("file", file)
+
+		info, err := os.Stat(file)
+
+		if err != nil {
+			ctx.WithError(err).Error("failed to read file")
+			return err
+		}
+
+		b, err := ioutil.ReadFile(file)
+
+		if err != nil {
+			ctx.WithError(err).Error("failed to read file")
+			return err
+		}
+
+		data, translations, err := deploy.MigrateDocument(string(b), p.isOverlay(file))
+
+		if err != nil {
+			ctx.WithError(err).Error("failed to migrate file")
+			return err
+		}
+
+		if len(translations) == 0 {
+			ctx.Info("nothing to migrate")
+			continue
+		}
+
+		for _, translation := range translations {
+			ctx.Info(translation)
+		}
+
+		if err := ioutil.WriteFile(file, []byte(data), info.Mode()); err != nil {
+			ctx.WithError(err).Error("failed to write file")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// format rewrites the files, the marathonfile and its overlays by default,
+// in their canonical YAML form. In check mode it only fails when some are not
+// formatted.
+func (p *Plugin) format(files []string, check bool) error {
+	if len(files) == 0 && p.Marathonfile != "" {
+		files = append([]string{p.Marathonfile}, p.Overlays...)
+	}
+
+	if len(files) == 0 {
+		return errors.New("no files to format")
+	}
+
+	var unformatted []string
+
+	for _, file := range files {
+		ctx := log.WithField("file", file)
+
+		info, err := os.Stat(file)
+
+		if err != nil {
+			ctx.WithError(err).Error("failed to read file")
+			return err
+		}
+
+		b, err := ioutil.ReadFile(file)
+
+		if err != nil {
+			ctx.WithError(err).Error("failed to read file")
+			return err
+		}
+
+		data, err := deploy.Format(string(b))
+
+		if err != nil {
+			ctx.WithError(err).Error("failed to format file")
+			return err
+		}
+
+		if data == string(b) {
+			continue
+		}
+
+		if check {
+			ctx.Warning("file is not formatted")
+			unformatted = append(unformatted, file)
+			continue
+		}
+
+		if err := ioutil.WriteFile(file, []byte(data), info.Mode()); err != nil {
+			ctx.WithError(err).Error("failed to write file")
+			return err
+		}
+
+		ctx.Info("file formatted")
+	}
+
+	if len(unformatted) > 0 {
+		return fmt.Errorf("%d files are not formatted: %s", len(unformatted), strings.Join(unformatted, ", "))
+	}
+
+	return nil
+}
+
+// export returns the definition of the given application, the application
+// being deployed by default, as a YAML or JSON marathonfile. Applications
+// under groups, or several ones, are written to one marathonfile each in dir.
+func (p *Plugin) export(c context.Context, ids []string, format, dir string) (string, error) {
+	if format != "yaml" && format != "json" {
+		err := fmt.Errorf("unknown export format %q", format)
+		log.WithError(err).Error("invalid export configuration")
+		return "", err
+	}
+
+	if len(ids) == 0 {
+		id, err := p.appID()
+
+		if err != nil {
+			return "", err
+		}
+
+		ids = []string{id}
+	}
+
+	client, networks, err := p.connect(c)
+
+	if err != nil {
+		return "", err
+	}
+
+	var defs []map[string]interface{}
+
+	for _, id := range ids {
+		exported, err := deploy.Export(client, id)
+
+		if err != nil {
+			log.WithError(err).WithField("app", id).Error("failed to export")
+			return "", err
+		}
+
+		defs = append(defs, exported...)
+	}
+
+	// keep the format the server expects, the transport converted them
+	if networks {
+		for _, def := range defs {
+			if _, err := deploy.MigrateNetworking(def); err != nil {
+				log.WithError(err).WithField("app", def["id"]).Error("failed to export")
+				return "", err
+			}
+		}
+	}
+
+	if dir == "" {
+		if len(defs) != 1 {
+			err := fmt.Errorf("%d applications exported, set --dir to write one marathonfile each", len(defs))
+			log.WithError(err).Error("failed to export")
+			return "", err
+		}
+
+		return deploy.EncodeDefinition(defs[0], format == "json")
+	}
+
+	files, err := deploy.WriteDefinitions(dir, defs, format == "json")
+
+	for _, file := range files {
+		log.WithField("file", file).Info("marathonfile written")
+	}
+
+	if err != nil {
+		log.WithError(err).WithField("dir", dir).Error("failed to write marathonfiles")
+		return "", err
+	}
+
+	return "", nil
+}
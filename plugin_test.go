@@ -1,9 +1,16 @@
 package main
 
 import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/quintoandar/drone-marathon/deploy"
+
 	gock "gopkg.in/h2non/gock.v1"
 )
 
@@ -44,14 +51,14 @@ healthChecks:
 const server = "http://marathon.mesos:8080"
 
 func TestAppDeploy(t *testing.T) {
-	deploy(t, app)
+	deployApp(t, app)
 }
 
 func TestAppWithURIDeploy(t *testing.T) {
-	deploy(t, appWithURI)
+	deployApp(t, appWithURI)
 }
 
-func deploy(t *testing.T, app string) {
+func deployApp(t *testing.T, app string) {
 	defer gock.Off()
 	gock.New(server).Get("/v2/deployments").Reply(200).JSON([]map[string]string{})
 	gock.New(server).Put("/v2/apps/quintoandar/app").Reply(201).
@@ -108,6 +115,11 @@ func TestAppFailedDeploy(t *testing.T) {
 		Reply(200).
 		JSON(map[string]string{})
 
+	gock.New(server).
+		Get("/v2/queue").
+		Reply(200).
+		JSON(map[string]interface{}{"queue": []interface{}{}})
+
 	// return an error once
 	gock.New(server).Times(1).Get("/v2/deployments").Reply(400).JSON([]map[string]string{})
 
@@ -163,6 +175,11 @@ func TestAppFailedDeployAndRollback(t *testing.T) {
 		Reply(200).
 		JSON(map[string]string{})
 
+	gock.New(server).
+		Get("/v2/queue").
+		Reply(200).
+		JSON(map[string]interface{}{"queue": []interface{}{}})
+
 	// return an error twice
 	gock.New(server).Times(2).Get("/v2/deployments").Reply(400).JSON([]map[string]string{})
 
@@ -184,3 +201,361 @@ func TestAppFailedDeployAndRollback(t *testing.T) {
 		t.Fatalf("gock.IsDone() false")
 	}
 }
+
+func TestAppInterruptedDeploy(t *testing.T) {
+	defer gock.Off()
+
+	gock.New(server).Put("/v2/apps/quintoandar/app").Reply(201).
+		JSON(map[string]string{
+			"deploymentId": "5ed4c0c5-9ff8-4a6f-a0cd-f57f59a34b43",
+			"version":      "2015-09-29T15:59:51.164Z",
+		})
+
+	// the deployment never finishes
+	gock.New(server).Persist().Get("/v2/deployments").Reply(200).
+		JSON([]map[string]interface{}{{
+			"id":    "5ed4c0c5-9ff8-4a6f-a0cd-f57f59a34b43",
+			"steps": []interface{}{},
+		}})
+
+	// cancel it (once)
+	gock.New(server).
+		Times(1).
+		Delete("/v2/deployments/5ed4c0c5-9ff8-4a6f-a0cd-f57f59a34b43").
+		MatchParam("force", "true").
+		Reply(202)
+
+	plugin := Plugin{
+		Server:      server,
+		AppConfig:   app,
+		OnCancel:    deploy.CancelDeployment,
+		CancelGrace: time.Duration(5) * time.Second,
+		Debug:       true,
+		Timeout:     time.Duration(5) * time.Minute,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := plugin.ExecContext(ctx); err == nil {
+		t.Fatalf("plugin.ExecContext did not fail: \n%v", err)
+	}
+
+	// guarantee that the deployment was cancelled
+	for _, m := range gock.Pending() {
+		if m.Request().Method == "DELETE" {
+			t.Fatalf("deployment was not cancelled")
+		}
+	}
+}
+
+func TestJobDeploy(t *testing.T) {
+	defer gock.Off()
+
+	metronome := "http://metronome.mesos"
+
+	gock.New(metronome).Get("/v1/jobs/reports").MatchHeader("Authorization", "token=secret").
+		Reply(404).JSON(map[string]string{"message": "Object not found"})
+	gock.New(metronome).Post("/v1/jobs").BodyString(`"id":"reports"`).
+		Reply(201).JSON(map[string]string{"id": "reports"})
+	gock.New(metronome).Post("/v1/jobs/reports/schedules").BodyString(`"cron":"0 3 \* \* \*"`).
+		Reply(201).JSON(map[string]string{"id": "daily"})
+
+	plugin := Plugin{
+		Mode:      modeJob,
+		Metronome: metronome,
+		Token:     "secret",
+		AppConfig: `{"id": "reports", "run": {"cpus": 0.1}, "schedules": [{"id": "daily", "cron": "0 3 * * *"}]}`,
+		Timeout:   time.Minute,
+	}
+
+	if err := plugin.Exec(); err != nil {
+		t.Fatalf("plugin.Exec failed: \n%v", err)
+	}
+
+	if !gock.IsDone() {
+		t.Fatalf("gock.IsDone() false")
+	}
+}
+
+func TestNetworkingDeploy(t *testing.T) {
+	defer gock.Off()
+
+	gock.New(server).Get("/v2/info").Reply(200).
+		JSON(map[string]string{"name": "marathon", "version": "1.5.2"})
+	gock.New(server).Get("/v2/deployments").Reply(200).JSON([]map[string]string{})
+	gock.New(server).Put("/v2/apps/quintoandar/app").
+		BodyString(`"networks":\[\{"mode":"container/bridge"\}\]`).
+		Reply(201).
+		JSON(map[string]string{
+			"deploymentId": "5ed4c0c5-9ff8-4a6f-a0cd-f57f59a34b43",
+			"version":      "2015-09-29T15:59:51.164Z",
+		})
+
+	plugin := Plugin{
+		Server:     server,
+		AppConfig:  app,
+		Networking: deploy.NetworkingAuto,
+		Timeout:    time.Minute,
+	}
+
+	if err := plugin.Exec(); err != nil {
+		t.Fatalf("plugin.Exec failed: \n%v", err)
+	}
+
+	if !gock.IsDone() {
+		t.Fatalf("gock.IsDone() false")
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	file, err := ioutil.TempFile("", "marathon")
+
+	if err != nil {
+		t.Fatalf("TempFile failed: \n%v", err)
+	}
+
+	defer os.Remove(file.Name())
+	file.WriteString(app)
+	file.Close()
+
+	plugin := Plugin{Marathonfile: file.Name()}
+
+	if err := plugin.migrate(nil); err != nil {
+		t.Fatalf("migrate failed: \n%v", err)
+	}
+
+	b, _ := ioutil.ReadFile(file.Name())
+	migrated, err := deploy.Parse(string(b))
+
+	if err != nil {
+		t.Fatalf("migrated file is invalid: \n%v", err)
+	}
+
+	if !strings.Contains(string(b), "container/bridge") || migrated.Container.Docker.Network != "BRIDGE" {
+		t.Fatalf("file was not migrated: \n%s", b)
+	}
+}
+
+func TestMigrateOverlay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "marathon")
+
+	if err != nil {
+		t.Fatalf("TempDir failed: \n%v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	base := filepath.Join(dir, "marathon.yaml")
+	overlay := filepath.Join(dir, "marathon.production.yaml")
+	ioutil.WriteFile(base, []byte(app), 0644)
+	ioutil.WriteFile(overlay, []byte("container:\n  docker:\n    network: HOST\n"), 0644)
+
+	plugin := Plugin{Marathonfile: base, Overlays: []string{overlay}}
+
+	if err := plugin.migrate(nil); err != nil {
+		t.Fatalf("migrate failed: \n%v", err)
+	}
+
+	rendered, err := plugin.input().Render()
+
+	if err != nil {
+		t.Fatalf("Render failed: \n%v", err)
+	}
+
+	migrated, err := deploy.Parse(rendered)
+
+	if err != nil {
+		t.Fatalf("migrated files are invalid: \n%v\n%s", err, rendered)
+	}
+
+	if migrated.Container.Docker.Network != "HOST" {
+		t.Fatalf("overlay network was not kept: \n%s", rendered)
+	}
+}
+
+func TestNetworkingDeployWithoutInfo(t *testing.T) {
+	defer gock.Off()
+
+	gock.New(server).Get("/v2/info").Reply(403)
+	gock.New(server).Get("/v2/deployments").Reply(200).JSON([]map[string]string{})
+	gock.New(server).Put("/v2/apps/quintoandar/app").
+		BodyString(`"network":"BRIDGE"`).
+		Reply(201).
+		JSON(map[string]string{
+			"deploymentId": "5ed4c0c5-9ff8-4a6f-a0cd-f57f59a34b43",
+			"version":      "2015-09-29T15:59:51.164Z",
+		})
+
+	plugin := Plugin{
+		Server:     server,
+		AppConfig:  app,
+		Networking: deploy.NetworkingAuto,
+		Timeout:    time.Minute,
+	}
+
+	if err := plugin.Exec(); err != nil {
+		t.Fatalf("plugin.Exec failed: \n%v", err)
+	}
+
+	if !gock.IsDone() {
+		t.Fatalf("gock.IsDone() false")
+	}
+}
+
+func TestExport(t *testing.T) {
+	defer gock.Off()
+
+	gock.New(server).Get("/v2/info").Reply(200).
+		JSON(map[string]string{"name": "marathon", "version": "1.5.2"})
+	gock.New(server).Get("/v2/apps/quintoandar/app").Reply(200).
+		JSON(map[string]interface{}{"app": map[string]interface{}{
+			"id":        "/quintoandar/app",
+			"instances": 1,
+			"version":   "2017-09-29T15:59:51.164Z",
+			"container": map[string]interface{}{
+				"type":         "DOCKER",
+				"docker":       map[string]interface{}{"image": "quintoandar/app", "privileged": false},
+				"portMappings": []map[string]interface{}{{"containerPort": 8080, "protocol": "tcp"}},
+			},
+			"networks": []map[string]string{{"mode": "container/bridge"}},
+			"tasks":    []interface{}{},
+		}})
+
+	plugin := Plugin{
+		Server:     server,
+		AppConfig:  app,
+		Networking: deploy.NetworkingAuto,
+	}
+
+	data, err := plugin.export(context.Background(), nil, "yaml", "")
+
+	if err != nil {
+		t.Fatalf("export failed: \n%v", err)
+	}
+
+	expected := `container:
+  docker:
+    image: quintoandar/app
+  portMappings:
+  - containerPort: 8080
+  type: DOCKER
+id: /quintoandar/app
+networks:
+- mode: container/bridge
+`
+
+	if data != expected {
+		t.Fatalf("unexpected export: \n%s", data)
+	}
+
+	if _, err := plugin.export(context.Background(), nil, "toml", ""); err == nil {
+		t.Fatalf("export accepted an unknown format")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	file, err := ioutil.TempFile("", "marathon")
+
+	if err != nil {
+		t.Fatalf("TempFile failed: \n%v", err)
+	}
+
+	defer os.Remove(file.Name())
+	file.WriteString(app)
+	file.Close()
+
+	plugin := Plugin{Marathonfile: file.Name()}
+
+	if err := plugin.format(nil, true); err == nil {
+		t.Fatalf("format did not fail on an unformatted file")
+	}
+
+	if err := plugin.format(nil, false); err != nil {
+		t.Fatalf("format failed: \n%v", err)
+	}
+
+	if err := plugin.format(nil, true); err != nil {
+		t.Fatalf("formatted file was not accepted: \n%v", err)
+	}
+
+	if b, _ := ioutil.ReadFile(file.Name()); !strings.HasPrefix(string(b), "id: quintoandar/app\n") {
+		t.Fatalf("file was not formatted: \n%s", b)
+	}
+}
+
+func TestGarbageCollection(t *testing.T) {
+	defer gock.Off()
+
+	gock.New(server).Get("/v2/apps").MatchParam("id", "/previews").Reply(200).
+		JSON(map[string]interface{}{"apps": []map[string]interface{}{
+			{"id": "/previews/12", "labels": map[string]string{deploy.LabelExpiresAt: "2017-09-29T15:59:51Z"}},
+			{"id": "/previews/13"},
+		}})
+
+	dir, err := ioutil.TempDir("", "marathon")
+
+	if err != nil {
+		t.Fatalf("TempDir failed: \n%v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	report := filepath.Join(dir, "report.json")
+
+	plugin := Plugin{
+		Server:        server,
+		Mode:          modeGC,
+		DestroyPrefix: "/previews",
+		DryRun:        true,
+		Report:        report,
+	}
+
+	if err := plugin.Exec(); err != nil {
+		t.Fatalf("plugin.Exec failed: \n%v", err)
+	}
+
+	if !gock.IsDone() {
+		t.Fatalf("gock.IsDone() false")
+	}
+
+	data, err := ioutil.ReadFile(report)
+
+	if err != nil {
+		t.Fatalf("failed to read the report: \n%v", err)
+	}
+
+	if !strings.Contains(string(data), `"app": "/previews"`) {
+		t.Fatalf("unexpected report: \n%s", data)
+	}
+
+	plugin.DestroyPrefix = ""
+
+	if err := plugin.Exec(); err == nil {
+		t.Fatalf("gc ran without a destroy prefix")
+	}
+}
+
+func TestInvalidDeploy(t *testing.T) {
+	defer gock.Off()
+
+	// any request to Marathon is unmatched
+	gock.Intercept()
+
+	plugin := Plugin{
+		Server:     server,
+		AppConfig:  strings.Replace(app, "path: /health", "portIndex: 1", 1),
+		Networking: deploy.NetworkingAuto,
+		Timeout:    time.Minute,
+	}
+
+	err := plugin.Exec()
+
+	if _, ok := err.(deploy.ValidationErrors); !ok {
+		t.Fatalf("plugin.Exec did not fail validation: \n%v", err)
+	}
+
+	if gock.HasUnmatchedRequest() {
+		t.Fatalf("requests were sent to Marathon")
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/quintoandar/drone-marathon/deploy"
+
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestReportSuccess(t *testing.T) {
+	defer gock.Off()
+
+	gock.New(server).Get("/v2/deployments").Reply(200).JSON([]map[string]string{})
+	gock.New(server).Put("/v2/apps/quintoandar/app").Reply(201).
+		JSON(map[string]string{
+			"deploymentId": "5ed4c0c5-9ff8-4a6f-a0cd-f57f59a34b43",
+			"version":      "2015-09-29T15:59:51.164Z",
+		})
+	gock.New(server).Get("/v2/apps/quintoandar/app").Reply(200).
+		JSON(map[string]interface{}{
+			"app": map[string]interface{}{
+				"id":           "quintoandar/app",
+				"instances":    2,
+				"tasksRunning": 2,
+				"tasksHealthy": 2,
+			},
+		})
+
+	report := execWithReport(t, false)
+
+	if report.Outcome != deploy.OutcomeSuccess || report.Error != "" {
+		t.Fatalf("unexpected outcome %q: %s", report.Outcome, report.Error)
+	}
+
+	if report.App != "quintoandar/app" ||
+		report.Deployment != "5ed4c0c5-9ff8-4a6f-a0cd-f57f59a34b43" ||
+		report.Version != "2015-09-29T15:59:51.164Z" {
+		t.Fatalf("unexpected report: \n%+v", report)
+	}
+
+	if report.Tasks == nil || report.Tasks.Instances != 2 || report.Tasks.Healthy != 2 {
+		t.Fatalf("unexpected task summary: \n%+v", report.Tasks)
+	}
+
+	if !gock.IsDone() {
+		t.Fatalf("gock.IsDone() false")
+	}
+}
+
+func TestReportRolledBack(t *testing.T) {
+	defer gock.Off()
+
+	// registered first, app paths would match it too
+	gock.New(server).Get("/v2/apps/quintoandar/app/tasks").Reply(200).
+		JSON(map[string]string{})
+
+	gock.New(server).Get("/v2/queue").Reply(200).
+		JSON(map[string]interface{}{"queue": []interface{}{}})
+
+	// previous version and final status
+	gock.New(server).Times(2).Get("/v2/apps/quintoandar/app").Reply(200).
+		File("test_response.json")
+
+	gock.New(server).Times(2).Put("/v2/apps/quintoandar/app").Reply(201).
+		JSON(map[string]string{
+			"deploymentId": "5ed4c0c5-9ff8-4a6f-a0cd-f57f59a34b43",
+			"version":      "2015-09-29T15:59:51.164Z",
+		})
+
+	gock.New(server).
+		Delete("/v2/deployments/5ed4c0c5-9ff8-4a6f-a0cd-f57f59a34b43").
+		Reply(202).
+		JSON(map[string]string{})
+
+	gock.New(server).Get("/v2/deployments").Reply(400).JSON([]map[string]string{})
+	gock.New(server).Get("/v2/deployments").Reply(200).JSON([]map[string]string{})
+
+	report := execWithReport(t, true)
+
+	if report.Outcome != deploy.OutcomeRolledBack || report.Error == "" {
+		t.Fatalf("unexpected outcome %q: %s", report.Outcome, report.Error)
+	}
+
+	if !gock.IsDone() {
+		t.Fatalf("gock.IsDone() false")
+	}
+}
+
+func execWithReport(t *testing.T, rollback bool) *deploy.Result {
+	dir, err := ioutil.TempDir("", "report")
+
+	if err != nil {
+		t.Fatalf("failed to create report dir: \n%v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	plugin := Plugin{
+		Server:    server,
+		AppConfig: app,
+		Report:    filepath.Join(dir, "deploy", "report.json"),
+		Rollback:  rollback,
+		Debug:     true,
+		Timeout:   time.Duration(5) * time.Minute,
+	}
+
+	plugin.Exec()
+
+	b, err := ioutil.ReadFile(plugin.Report)
+
+	if err != nil {
+		t.Fatalf("report was not written: \n%v", err)
+	}
+
+	var report deploy.Result
+
+	if err := json.Unmarshal(b, &report); err != nil {
+		t.Fatalf("invalid report: \n%v", err)
+	}
+
+	return &report
+}